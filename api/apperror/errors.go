@@ -77,3 +77,26 @@ func IsNotFoundError(err error) bool {
 	var notFoundErr *NotFoundError
 	return errors.As(err, &notFoundErr) || errors.Is(err, os.ErrNotExist)
 }
+
+type ConflictError struct {
+	wrappedError error
+}
+
+func NewConflictError(wrappedError error) *ConflictError {
+	return &ConflictError{
+		wrappedError: wrappedError,
+	}
+}
+
+func (ce *ConflictError) Error() string {
+	return ce.wrappedError.Error()
+}
+
+func (ce *ConflictError) Unwrap() error {
+	return ce.wrappedError
+}
+
+func IsConflictError(err error) bool {
+	var conflictErr *ConflictError
+	return errors.As(err, &conflictErr)
+}
@@ -6,7 +6,15 @@ var DEFAULT_USER_SCHEMA = map[string]interface{}{
 	DEFAULT_FIRST_OPTION: nil,
 }
 
-const (
-	DEFAULT_SCHEMA_PATH = "data/personal_data/schema.json"
-	DEFAULT_DATA_PATH   = "data/personal_data/data.csv"
-)
+// LEGACY_DATA_DIR is where data was kept, relative to the checkout, before
+// its location was configurable.
+const LEGACY_DATA_DIR = "data/personal_data"
+
+// DEFAULT_SCHEMA_BACKUPS is how many previous versions of schema.json are kept next to it.
+const DEFAULT_SCHEMA_BACKUPS = 3
+
+// DEFAULT_PROFILE is the profile used unless another is picked. Its files
+// live right in the data directory, other profiles' under PROFILES_DIR in it.
+const DEFAULT_PROFILE = "default"
+
+const PROFILES_DIR = "profiles"
@@ -1,6 +1,15 @@
 package constructs
 
-import "activity_log/internal/util"
+import (
+	"activity_log/internal/util"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type UserInput struct {
 	Text string
@@ -11,8 +20,17 @@ type UserSchema struct {
 }
 
 type UserData struct {
-	Data        map[string]interface{}
+	// ID is assigned by the UserDataDAO on Append.
+	ID   string
+	Data map[string]interface{}
+	// TimestampMS is when the activity ended, which for records logged as
+	// they happen is when they were logged.
 	TimestampMS int64
+	// StartMS and EndMS are when the activity happened. Records from before
+	// they were kept leave them zero, Start and End then fall back on
+	// TimestampMS and the minutes.
+	StartMS int64
+	EndMS   int64
 }
 
 type UserDataKey string
@@ -20,4 +38,226 @@ type UserDataKey string
 var (
 	Activity     UserDataKey = "ACTIVITY"
 	MinutesSpent UserDataKey = "MINUTES"
+	// Note is free text about the activity. Records without one leave it out.
+	Note UserDataKey = "NOTE"
+	// Tags are kept space separated, without their leading #. Records without
+	// any leave it out.
+	Tags UserDataKey = "TAGS"
 )
+
+// NewUserDataID returns a random identifier for a record.
+func NewUserDataID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("rand.Read() returns err: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// ActivityPath returns the dot separated schema path the record was logged against.
+func (ud *UserData) ActivityPath() string {
+	activity, ok := ud.Data[string(Activity)]
+	if !ok || activity == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", activity)
+}
+
+// Minutes returns the minutes spent on the activity, or an error if the
+// record doesn't carry a numeric value.
+func (ud *UserData) Minutes() (int, error) {
+	switch minutes := ud.Data[string(MinutesSpent)].(type) {
+	case int:
+		return minutes, nil
+	case int64:
+		return int(minutes), nil
+	case float64:
+		return int(minutes), nil
+	case string:
+		digit, err := strconv.Atoi(minutes)
+		if err != nil {
+			return 0, fmt.Errorf("strconv.Atoi(%q) returns err: %w", minutes, err)
+		}
+		return digit, nil
+	default:
+		return 0, fmt.Errorf("record has no minutes, got %T", minutes)
+	}
+}
+
+func (ud *UserData) Note() string {
+	note, ok := ud.Data[string(Note)]
+	if !ok || note == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", note)
+}
+
+func (ud *UserData) SetNote(note string) {
+	if note == "" {
+		delete(ud.Data, string(Note))
+		return
+	}
+	ud.Data[string(Note)] = note
+}
+
+// Tags returns the record's tags without their leading #.
+func (ud *UserData) Tags() []string {
+	tags, ok := ud.Data[string(Tags)]
+	if !ok || tags == nil {
+		return nil
+	}
+	return strings.Fields(fmt.Sprintf("%v", tags))
+}
+
+// SetTags replaces the record's tags, normalized with NormalizeTag, sorted and without duplicates.
+func (ud *UserData) SetTags(tags []string) {
+	set := map[string]bool{}
+	for _, tag := range tags {
+		if tag = NormalizeTag(tag); tag != "" {
+			set[tag] = true
+		}
+	}
+
+	if len(set) == 0 {
+		delete(ud.Data, string(Tags))
+		return
+	}
+
+	normalized := []string{}
+	for tag := range set {
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	ud.Data[string(Tags)] = strings.Join(normalized, " ")
+}
+
+func (ud *UserData) HasTag(tag string) bool {
+	tag = NormalizeTag(tag)
+	for _, have := range ud.Tags() {
+		if have == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTag drops the leading # and lowercases tag, so #Pairing and pairing are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// String is the record the way it's shown to the user, e.g.
+// "2021-11-12 10:00-10:45 working.coding 45m #ticket-123 fixed the parser".
+func (ud *UserData) String() string {
+	minutes, _ := ud.Minutes()
+	formatted := fmt.Sprintf("%s-%s %s %dm", ud.Start().Format("2006-01-02 15:04"), ud.End().Format("15:04"), ud.ActivityPath(), minutes)
+	for _, tag := range ud.Tags() {
+		formatted += " #" + tag
+	}
+	if note := ud.Note(); note != "" {
+		formatted += " " + note
+	}
+	return formatted
+}
+
+func (ud *UserData) Time() time.Time {
+	return msToTime(ud.TimestampMS)
+}
+
+func (ud *UserData) Start() time.Time {
+	if ud.StartMS != 0 {
+		return msToTime(ud.StartMS)
+	}
+
+	minutes, _ := ud.Minutes()
+	return ud.End().Add(-time.Duration(minutes) * time.Minute)
+}
+
+func (ud *UserData) End() time.Time {
+	if ud.EndMS != 0 {
+		return msToTime(ud.EndMS)
+	}
+	return ud.Time()
+}
+
+// SetSpan records when the activity happened, ending the record at end.
+func (ud *UserData) SetSpan(start time.Time, end time.Time) {
+	ud.StartMS = TimeToMS(start)
+	ud.EndMS = TimeToMS(end)
+	ud.TimestampMS = ud.EndMS
+}
+
+// Overlaps reports whether the record shares any time with [start, end).
+func (ud *UserData) Overlaps(start time.Time, end time.Time) bool {
+	return ud.Start().Before(end) && start.Before(ud.End())
+}
+
+// TimeToMS is t the way records store it, in milliseconds since the epoch.
+func TimeToMS(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func msToTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// Timer is an activity being timed as it happens, until it is stopped and
+// becomes a record.
+type Timer struct {
+	Activity string
+	StartMS  int64
+}
+
+func (t *Timer) Start() time.Time {
+	return msToTime(t.StartMS)
+}
+
+// UserDataFilter narrows a read of the data log. Zero values don't filter.
+type UserDataFilter struct {
+	// SinceMS is the inclusive lower bound on TimestampMS.
+	SinceMS int64
+	// UntilMS is the exclusive upper bound on TimestampMS.
+	UntilMS int64
+	// ActivityPrefix matches the activity itself and everything below it,
+	// e.g. "working.coding" matches "working.coding.debugging" but not "working.codingX".
+	ActivityPrefix string
+	// Tags matches records carrying every one of them, with or without their #.
+	Tags []string
+	// NoteContains matches records whose note contains it, ignoring case.
+	NoteContains string
+}
+
+func (udf *UserDataFilter) Matches(data *UserData) bool {
+	if udf == nil {
+		return true
+	}
+
+	if udf.SinceMS != 0 && data.TimestampMS < udf.SinceMS {
+		return false
+	}
+
+	if udf.UntilMS != 0 && data.TimestampMS >= udf.UntilMS {
+		return false
+	}
+
+	if udf.ActivityPrefix != "" && !ActivityHasPrefix(data.ActivityPath(), udf.ActivityPrefix) {
+		return false
+	}
+
+	for _, tag := range udf.Tags {
+		if !data.HasTag(tag) {
+			return false
+		}
+	}
+
+	if udf.NoteContains != "" && !strings.Contains(strings.ToLower(data.Note()), strings.ToLower(udf.NoteContains)) {
+		return false
+	}
+
+	return true
+}
+
+// ActivityHasPrefix reports whether the dot separated activity is prefix or lives under it.
+func ActivityHasPrefix(activity string, prefix string) bool {
+	return activity == prefix || strings.HasPrefix(activity, prefix+".")
+}
@@ -1,30 +1,146 @@
 package main
 
 import (
-	"activity_log/api/constants"
 	"activity_log/internal/chatter"
-	datadao "activity_log/internal/dao/data_dao"
-	schemadao "activity_log/internal/dao/schema_dao"
+	"activity_log/internal/command"
+	"activity_log/internal/config"
+	"activity_log/internal/dao/backend"
+	"activity_log/internal/initializer"
+	"activity_log/internal/notifier"
 	"activity_log/internal/user_input"
 	cli "activity_log/internal/user_input/service"
 	"activity_log/internal/user_output"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 func main() {
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\nWithout a command, asks what you're doing until you quit.\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		command.PrintUsage(flag.CommandLine.Output())
+	}
+	flag.Parse()
+
+	cfg, err := loader.Load(os.Getenv)
+	if err != nil {
+		if flag.Arg(0) != "init" {
+			log.Fatalf("loader.Load() returns err: %v\nactivity_log init repairs the config file.", err)
+		}
+
+		// init rewrites the config file, so it mustn't depend on it.
+		log.Printf("Ignoring the config file: %v", err)
+		if cfg, err = loader.LoadWithoutFile(os.Getenv); err != nil {
+			log.Fatalf("loader.LoadWithoutFile() returns err: %v", err)
+		}
+	}
+
+	// Only commands that manage profiles or set one up may name one that doesn't exist yet.
+	switch flag.Arg(0) {
+	case "profile", "init", "config":
+	default:
+		if !cfg.HasProfile(cfg.Profile) {
+			log.Fatalf("There's no profile %q, activity_log profile create %s makes it.", cfg.Profile, cfg.Profile)
+		}
+	}
+
+	// Interrupting abandons the round in progress, new options are still saved.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	userListener := user_input.New(&cli.CLIListener{})
 	userMessenger := &user_output.UserMessenger{}
+	userListener := user_input.New(cli.NewCLIListener(os.Stdin), userMessenger)
 
-	userSchemaDAO := schemadao.NewLocalSchemaDAO(constants.DEFAULT_SCHEMA_PATH)
-	userDataDAO := datadao.NewDataDAO(constants.DEFAULT_DATA_PATH)
+	if flag.NArg() == 0 && initializer.IsFirstRun(cfg) {
+		if err := initializer.New(userListener, userMessenger, cfg).Init(ctx); err != nil {
+			stop()
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			log.Fatalf("Init() returns err: %v", err)
+		}
+
+		// Pick up what was set up.
+		if cfg, err = loader.Load(os.Getenv); err != nil {
+			log.Fatalf("loader.Load() returns err: %v", err)
+		}
+	}
+	wizard := initializer.New(userListener, userMessenger, cfg)
+
+	// Reporting on the config shouldn't create anything, and profile
+	// commands create the profiles they're asked to.
+	if flag.Arg(0) != "config" && flag.Arg(0) != "profile" {
+		if err := cfg.MakeDirs(); err != nil {
+			log.Fatalf("MakeDirs() returns err: %v", err)
+		}
+	}
+
+	daos, err := backend.Open(cfg)
+	if err != nil {
+		log.Fatalf("backend.Open() returns err: %v", err)
+	}
+
+	if flag.NArg() > 0 {
+		env := &command.Env{
+			SchemaDAO:   daos.Schema,
+			DataDAO:     daos.Data,
+			TimerDAO:    daos.Timer,
+			Out:         os.Stdout,
+			Now:         time.Now,
+			Config:      cfg,
+			Initializer: wizard,
+		}
+
+		if err := command.Run(ctx, env, flag.Args()); err != nil {
+			stop()
+			if errors.Is(err, flag.ErrHelp) || errors.Is(err, context.Canceled) {
+				return
+			}
+			log.Fatalf("%s: %v", flag.Arg(0), err)
+		}
+		return
+	}
+
+	reminderNotifier, err := notifier.New(notifier.Kind(cfg.Notifier), cfg.NotifyCommand, os.Stdout)
+	if err != nil {
+		log.Fatalf("notifier.New() returns err: %v", err)
+	}
 
 	chatterConfig := &chatter.ChatterConfig{
-		ResponseWait:        time.Minute,
-		MaxConfusionRetries: 3,
+		ResponseWait:        cfg.ResponseWait,
+		MaxConfusionRetries: cfg.MaxConfusionRetries,
+		MaxLastRecordWait:   cfg.MaxLastRecordWait,
+
+		ReminderSettingsPath: cfg.ReminderSettingsPath,
+		ReminderSchedule:     cfg.ReminderSchedule,
+
+		Color: isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "",
 	}
 
-	chatter := chatter.NewChatter(userListener, userMessenger, userSchemaDAO, userDataDAO, chatterConfig)
+	chatter := chatter.NewChatter(userListener, userMessenger, daos.Schema, daos.Data, daos.Timer, reminderNotifier, wizard, chatterConfig)
+
+	err = chatter.Run(ctx)
+	stop()
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Run() returns err: %v", err)
+	}
+}
 
-	chatter.Run()
+// isTerminal reports whether f is a terminal rather than, say, a pipe or a file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
@@ -0,0 +1,45 @@
+// Command migrate imports a schema.json/data.csv pair into a bbolt database.
+package main
+
+import (
+	"activity_log/api/constants"
+	"activity_log/internal/config"
+	boltdao "activity_log/internal/dao/bolt_dao"
+	datadao "activity_log/internal/dao/data_dao"
+	schemadao "activity_log/internal/dao/schema_dao"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// The -schema and -data flags pick what to import and -db what to import
+// into, created if missing, like they pick what activity_log uses.
+func main() {
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := loader.Load(os.Getenv)
+	if err != nil {
+		log.Fatalf("loader.Load() returns err: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cfg.MakeDirs(); err != nil {
+		log.Fatalf("MakeDirs() returns err: %v", err)
+	}
+
+	boltDAO := boltdao.NewBoltDAO(cfg.DBPath)
+
+	imported, err := boltDAO.Import(ctx, schemadao.NewLocalSchemaDAO(cfg.SchemaPath, constants.DEFAULT_SCHEMA_BACKUPS), datadao.NewDataDAO(cfg.DataPath))
+	if err != nil {
+		log.Fatalf("Import() returns err: %v", err)
+	}
+
+	fmt.Printf("Imported %s and %d records from %s into %s\n", cfg.SchemaPath, imported, cfg.DataPath, cfg.DBPath)
+}
@@ -1,3 +1,8 @@
 module activity_log
 
 go 1.16
+
+require (
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/sys v0.0.0-20200923182605-d9f96fdee20d
+)
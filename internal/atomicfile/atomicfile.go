@@ -0,0 +1,61 @@
+// Package atomicfile replaces files so that readers, and the file after a
+// crash, see either the old contents or the new ones, never part of either.
+package atomicfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Write writes data to a temp file next to path, fsyncs it and renames it
+// over path. A file that already exists at path keeps its mode, a new one
+// gets perm.
+func Write(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("ioutil.TempFile() returns err: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Chmod() returns err: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Write() returns err: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Sync() returns err: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Close() returns err: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("os.Rename(%s, %s) returns err: %w", tmp.Name(), path, err)
+	}
+
+	// Persist the rename itself.
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("os.Open(%s) returns err: %w", dir, err)
+	}
+	defer dirFile.Close()
+
+	// Not every platform can fsync a directory, the rename has happened either way.
+	_ = dirFile.Sync()
+
+	return nil
+}
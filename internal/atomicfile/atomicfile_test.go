@@ -0,0 +1,43 @@
+package atomicfile_test
+
+import (
+	"activity_log/internal/atomicfile"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.json")
+
+	if err := atomicfile.Write(path, []byte("first"), 0600); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatalf("Chmod() returns err: %v", err)
+	}
+	if err := atomicfile.Write(path, []byte("second"), 0600); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	if string(got) != "second" {
+		t.Errorf("Write() leaves %q, want %q", got, "second")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Write() leaves mode %v (err: %v), want the file's own 0640", info.Mode().Perm(), err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() returns err: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Write() leaves %d files behind, want just %s", len(entries), path)
+	}
+}
@@ -5,23 +5,41 @@ import (
 	"activity_log/api/constants"
 	"activity_log/api/constructs"
 	"activity_log/internal/dao"
+	"activity_log/internal/initializer"
+	"activity_log/internal/notifier"
+	"activity_log/internal/reminder"
 	"activity_log/internal/user_input"
 	"activity_log/internal/user_output"
 	"activity_log/internal/util"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os/exec"
+	"io"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-const MaxLastRecordMinutesDefault = time.Hour
+// maxDumpAttempts bounds how often a schema dump retries after losing a race to another process.
+const maxDumpAttempts = 3
+
+// shutdownFlushTimeout bounds how long saving a round's new options may hold up shutdown.
+const shutdownFlushTimeout = 5 * time.Second
 
 type ChatterConfig struct {
 	ResponseWait        time.Duration
 	MaxConfusionRetries int
+	// MaxLastRecordWait is how long since the last record an empty answer
+	// to "how many minutes" may still log.
+	MaxLastRecordWait time.Duration
+	// ReminderSettingsPath is where the reminder schedule is saved.
+	ReminderSettingsPath string
+	// ReminderSchedule is used instead of the saved schedule if set.
+	ReminderSchedule string
+	// Color shows options in the menu in their colors.
+	Color bool
 }
 
 type Chatter struct {
@@ -29,9 +47,33 @@ type Chatter struct {
 	userMessenger *user_output.UserMessenger
 	userSchemaDAO dao.UserSchemaDAO
 	userDataDAO   dao.UserDataDAO
+	timerDAO      dao.TimerDAO
+	notifier      notifier.Notifier
+	initializer   *initializer.Initializer
 
 	chatterConfig  *ChatterConfig
 	lastRecordTime time.Time
+
+	// scheduler is nil until reminders are set up.
+	scheduler *reminder.Scheduler
+	// answering is 1 from the user's first answer in a round until the round
+	// ends, reminders wait while it is. Accessed atomically.
+	answering int32
+
+	// undoStack holds the records appended this session, newest last.
+	undoStack []*sessionRecord
+	// redoStack holds the records undone this session, most recently undone last.
+	redoStack []*sessionRecord
+
+	// schemaBase is the stored schema the round's menu was last brought up
+	// to date with. What the menu has on top of it was added this round.
+	schemaBase *util.ExpandingMap
+}
+
+// sessionRecord remembers enough about an append to take it back.
+type sessionRecord struct {
+	userData           *constructs.UserData
+	previousRecordTime time.Time
 }
 
 func NewChatter(
@@ -39,6 +81,9 @@ func NewChatter(
 	userMessenger *user_output.UserMessenger,
 	userSchemaDAO dao.UserSchemaDAO,
 	userDataDAO dao.UserDataDAO,
+	timerDAO dao.TimerDAO,
+	notifier notifier.Notifier,
+	initializer *initializer.Initializer,
 	chatterConfig *ChatterConfig,
 ) *Chatter {
 	return &Chatter{
@@ -46,131 +91,326 @@ func NewChatter(
 		userMessenger: userMessenger,
 		userSchemaDAO: userSchemaDAO,
 		userDataDAO:   userDataDAO,
+		timerDAO:      timerDAO,
+		notifier:      notifier,
+		initializer:   initializer,
 		chatterConfig: chatterConfig,
 
 		lastRecordTime: time.Now(),
 	}
 }
 
-func (ctr *Chatter) Run() {
-	go ctr.setUpReminders()
+// Run asks the user for activity round after round. It returns nil once
+// input ends, ctx.Err() once ctx is done, and any other error that stops it.
+// Either way the round in progress is abandoned after saving its new options.
+func (ctr *Chatter) Run(ctx context.Context) error {
+	// The input owner and the reminders stop with Run.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	time.Sleep(time.Second * time.Duration(3))
+	go ctr.userListener.Serve(ctx)
+
+	if err := ctr.setUpReminders(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("setUpReminders() returns err: %w", err)
+	}
 
 	for {
-		if err := ctr.round(); err != nil {
-			log.Fatalf(err.Error())
+		err := ctr.round(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if apperror.IsTimeoutError(err) {
+			err = ctr.waitForUser(ctx)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
 		}
 	}
 }
 
-func (ctr *Chatter) round() error {
+// round returns a TimeoutError, io.EOF or ctx.Err() if the user stopped
+// answering part way, after saving any options added so far.
+func (ctr *Chatter) round(ctx context.Context) error {
+	defer atomic.StoreInt32(&ctr.answering, 0)
 
-	userSchema, err := ctr.getUserSchema()
+	userSchema, err := ctr.getUserSchema(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get user schema: %w", err)
 	}
 
-	existingSchema := userSchema.Schema.ToRegularMap()
+	ctr.schemaBase = userSchema.Schema.Copy()
 
-	if err := ctr.writeRound([]string{}, userSchema.Schema); err != nil {
-		if err := ctr.userMessenger.Send(fmt.Sprintf("ERROR: %v", err)); err != nil {
+	writeErr := ctr.writeRound(ctx, []string{}, userSchema.Schema, ctr.logMinutes)
+	if writeErr != nil && !isAbandoned(writeErr) {
+		if err := ctr.userMessenger.Send(fmt.Sprintf("ERROR: %v", writeErr)); err != nil {
 			return fmt.Errorf("couldn't log error to user. err: %w", err)
 		}
 	}
 
-	if err := util.NestedMapsEqual(existingSchema, userSchema.Schema.ToRegularMap()); err != nil {
-		if err := ctr.userSchemaDAO.Dump(userSchema, true); err != nil {
-			return fmt.Errorf("couldn't record schema change, err: %w", err)
+	if err := ctr.schemaBase.IsEqual(userSchema.Schema); err != nil {
+		// Options added before a shutdown are still worth keeping.
+		dumpCtx := ctx
+		if ctx.Err() != nil {
+			var cancel context.CancelFunc
+			dumpCtx, cancel = context.WithTimeout(context.Background(), shutdownFlushTimeout)
+			defer cancel()
+		}
+
+		if err := ctr.dumpSchema(dumpCtx, userSchema); err != nil {
+			if !apperror.IsConflictError(err) {
+				return fmt.Errorf("couldn't record schema change, err: %w", err)
+			}
+
+			if err := ctr.userMessenger.Send(fmt.Sprintf("ERROR: new options from this round were not saved: %v", err)); err != nil {
+				return fmt.Errorf("couldn't log error to user. err: %w", err)
+			}
+		}
+	}
+
+	if isAbandoned(writeErr) {
+		return writeErr
+	}
+
+	return nil
+}
+
+// waitForUser holds off the next round until the user is back at the keyboard.
+func (ctr *Chatter) waitForUser(ctx context.Context) error {
+	msg := fmt.Sprintf("No answer within %v, abandoning this round. Press enter when you're ready to log.", ctr.chatterConfig.ResponseWait)
+	if _, err := ctr.userListener.Ask(ctx, msg, 0, 0, func(*constructs.UserInput) error { return nil }); err != nil {
+		return fmt.Errorf("Ask() returns err: %w", err)
+	}
+
+	return nil
+}
+
+// isAbandoned reports whether err means the user stopped answering, or the
+// chatter is shutting down, rather than the user answered wrong.
+func isAbandoned(err error) bool {
+	return apperror.IsTimeoutError(err) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// dumpSchema saves userSchema, the round's menu, on top of whatever other
+// processes saved since it was loaded.
+func (ctr *Chatter) dumpSchema(ctx context.Context, userSchema *constructs.UserSchema) error {
+	var err error
+	for attempt := 0; attempt < maxDumpAttempts; attempt++ {
+		err = ctr.userSchemaDAO.Dump(ctx, userSchema, false)
+		if err == nil {
+			ctr.schemaBase = userSchema.Schema.Copy()
+			return nil
+		}
+		if !apperror.IsConflictError(err) {
+			return err
+		}
+
+		if err := ctr.mergeStoredSchema(ctx, userSchema.Schema); err != nil {
+			return fmt.Errorf("mergeStoredSchema() returns err: %w", err)
 		}
 	}
 
+	return err
+}
+
+// reloadSchemaIfChanged picks up what other processes saved while this one was waiting on the user.
+func (ctr *Chatter) reloadSchemaIfChanged(ctx context.Context, expandingMap *util.ExpandingMap) error {
+	changed, err := ctr.userSchemaDAO.HasChanged(ctx)
+	if err != nil {
+		return fmt.Errorf("userSchemaDAO.HasChanged() returns err: %w", err)
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return ctr.mergeStoredSchema(ctx, expandingMap)
+}
+
+// mergeStoredSchema replaces expandingMap, the round's menu, with the stored
+// schema plus the options added this round. Renames, moves and deletes saved
+// by other processes are kept rather than undone.
+func (ctr *Chatter) mergeStoredSchema(ctx context.Context, expandingMap *util.ExpandingMap) error {
+	stored, err := ctr.userSchemaDAO.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("userSchemaDAO.Load() returns err: %w", err)
+	}
+
+	expandingMap.Rebase(ctr.schemaBase, stored.Schema)
+	ctr.schemaBase = stored.Schema
+
 	return nil
 }
 
-func (ctr *Chatter) writeRound(path []string, expandingMap *util.ExpandingMap) error {
+// leafHandler acts on an activity the user picked from the menu, path ends at an option with no sub-options.
+type leafHandler func(ctx context.Context, path []string, expandingMap *util.ExpandingMap) error
+
+// writeRound walks the user down the menu from path, adding the options they
+// type along the way, and hands the activity they pick to onLeaf.
+func (ctr *Chatter) writeRound(ctx context.Context, path []string, expandingMap *util.ExpandingMap, onLeaf leafHandler) error {
+	if err := ctr.reloadSchemaIfChanged(ctx, expandingMap); err != nil {
+		return fmt.Errorf("reloadSchemaIfChanged() returns err: %w", err)
+	}
+
 	subExpandingMap, err := expandingMap.GetSubMap(path)
 	if err != nil {
 		return fmt.Errorf("GetSubMap(%v) returns err: %w", path, err)
 	}
 
-	userInput, options, err := ctr.getOptionOrText(path, subExpandingMap)
+	userInput, options, err := ctr.getOptionOrText(ctx, path, subExpandingMap)
 	if err != nil {
 		return fmt.Errorf("getOptionOrText() returns err: %w", err)
 	}
 
+	if commandText, ok := asCommand(userInput.Text); ok {
+		if err := ctr.runCommand(ctx, commandText, expandingMap); err != nil {
+			if isAbandoned(err) {
+				return err
+			}
+			if err := ctr.userMessenger.Send(fmt.Sprintf("ERROR: %v", err)); err != nil {
+				return fmt.Errorf("userMessenger.Send() returns err: %w", err)
+			}
+		}
+		if len(path) == 0 {
+			// Back at the first question with nothing chosen yet.
+			atomic.StoreInt32(&ctr.answering, 0)
+		}
+		return ctr.writeRound(ctx, path, expandingMap, onLeaf)
+	}
+
 	if choiceDigit, err := strconv.Atoi(userInput.Text); err == nil {
-		// Get input.
 		path = append(path, options[choiceDigit])
 
 		if subMap, err := expandingMap.GetSubMap(path); err == nil {
-			if !subMap.IsEmpty() {
-				return ctr.writeRound(path, expandingMap)
+			// Sub-options that are all archived leave nothing to choose from.
+			if len(subMap.VisibleKeys()) > 0 {
+				return ctr.writeRound(ctx, path, expandingMap, onLeaf)
 			}
 		} else {
 			return fmt.Errorf("no submap at this choice -- implementation error")
 		}
 
-		if err := ctr.userMessenger.Send(fmt.Sprintf("%s -- how many minutes did you do this for?", options[choiceDigit])); err != nil {
-			return fmt.Errorf("userMessenger.Send() returns err: %w", err)
+		return onLeaf(ctx, path, expandingMap)
+	} else {
+		// Add option.
+		if err := archivedOption(expandingMap, path, userInput.Text); err != nil {
+			return err
 		}
-
-		userInput, err = ctr.userListener.GetUserInput(
-			ctr.chatterConfig.ResponseWait,
-			ctr.chatterConfig.MaxConfusionRetries,
-			func(ui *constructs.UserInput) error {
-				return nil
-			},
-		)
-		if err != nil {
-			return fmt.Errorf("GetUserInput() returns err: %w", err)
+		if _, ok := subExpandingMap.ToRegularMap()[userInput.Text]; ok {
+			return fmt.Errorf("option already exists")
 		}
 
-		// Record or add option.
-		if userInput.Text == "" {
-			if time.Since(ctr.lastRecordTime) > MaxLastRecordMinutesDefault {
-				return fmt.Errorf("time since last record is greater than %v, please specify minutes", MaxLastRecordMinutesDefault)
-			}
-			userInput.Text = fmt.Sprintf("%d", int(time.Since(ctr.lastRecordTime).Minutes()))
+		if err := expandingMap.AddSubMap(path, userInput.Text); err != nil {
+			return fmt.Errorf("AddSubMap(%v, %s) returns err: %w", path, userInput.Text, err)
 		}
+		return ctr.writeRound(ctx, path, expandingMap, onLeaf)
+	}
+}
 
-		if digit, err := strconv.Atoi(userInput.Text); err == nil {
-			if err := ctr.recordValue(path, digit); err != nil {
-				return fmt.Errorf("recordValue() returns err: %v", err)
-			}
-			return nil
-		} else {
-			if choiceDigit == 0 {
-				return fmt.Errorf("cannot expand first option")
+// logMinutes is the leaf handler of a regular round. It asks how long the
+// activity took and records it, or adds what the user typed instead as a
+// sub-option and carries on down the menu.
+func (ctr *Chatter) logMinutes(ctx context.Context, path []string, expandingMap *util.ExpandingMap) error {
+	userInput, err := ctr.userListener.Ask(
+		ctx,
+		fmt.Sprintf("%s -- how many minutes did you do this for? 45, 1h30m, since 14:00 and 14:00-15:30 all work.", path[len(path)-1]),
+		ctr.chatterConfig.ResponseWait,
+		ctr.chatterConfig.MaxConfusionRetries,
+		func(ui *constructs.UserInput) error {
+			if !util.LooksLikeTimeSpan(ui.Text) {
+				return nil
 			}
+			_, err := util.ParseTimeSpan(ui.Text, time.Now(), ctr.lastRecordTime)
+			return err
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("Ask() returns err: %w", err)
+	}
 
-			if err := expandingMap.AddSubMapIncludingParent(path, userInput.Text); err != nil {
-				return fmt.Errorf("AddSubMapIncludingParent(%v, %s) returns err: %w", path, userInput.Text, err)
-			}
+	// Record or add option.
+	if userInput.Text == "" {
+		if time.Since(ctr.lastRecordTime) > ctr.chatterConfig.MaxLastRecordWait {
+			return fmt.Errorf("time since last record is greater than %v, please specify minutes", ctr.chatterConfig.MaxLastRecordWait)
+		}
+		userInput.Text = "until now"
+	}
 
-			return ctr.writeRound(path, expandingMap)
+	if util.LooksLikeTimeSpan(userInput.Text) {
+		span, err := util.ParseTimeSpan(userInput.Text, time.Now(), ctr.lastRecordTime)
+		if err != nil {
+			return fmt.Errorf("ParseTimeSpan(%s) returns err: %w", userInput.Text, err)
 		}
-	} else {
-		// Add option.
-		if _, ok := subExpandingMap.ToRegularMap()[userInput.Text]; ok {
-			return fmt.Errorf("option already exists")
+
+		ann, err := ctr.askAnnotation(ctx)
+		if err != nil {
+			return fmt.Errorf("askAnnotation() returns err: %w", err)
 		}
 
-		if err := expandingMap.AddSubMap(path, userInput.Text); err != nil {
-			return fmt.Errorf("AddSubMap(%v, %s) returns err: %w", path, userInput.Text, err)
+		if err := ctr.recordValue(ctx, path, span, ann); err != nil {
+			return fmt.Errorf("recordValue() returns err: %w", err)
 		}
-		return ctr.writeRound(path, expandingMap)
+		return nil
+	}
+
+	if isDefaultOption(path) {
+		return fmt.Errorf("cannot expand first option")
+	}
+
+	if err := archivedOption(expandingMap, path, userInput.Text); err != nil {
+		return err
+	}
+	if err := expandingMap.AddSubMapIncludingParent(path, userInput.Text); err != nil {
+		return fmt.Errorf("AddSubMapIncludingParent(%v, %s) returns err: %w", path, userInput.Text, err)
 	}
+
+	return ctr.writeRound(ctx, path, expandingMap, ctr.logMinutes)
+}
+
+// archivedOption returns an error saying how to get option, under parent,
+// back if it's archived, and nil otherwise.
+func archivedOption(expandingMap *util.ExpandingMap, parent []string, option string) error {
+	path := append(append([]string{}, parent...), option)
+	if !expandingMap.IsArchived(path) {
+		return nil
+	}
+	return fmt.Errorf("%s is archived, %sunarchive puts it back in the menu", strings.Join(path, "."), commandPrefix)
+}
+
+// isDefaultOption reports whether path ends at the option that stands for
+// its parent itself, which is listed first.
+func isDefaultOption(path []string) bool {
+	if len(path) == 1 {
+		return path[0] == constants.DEFAULT_FIRST_OPTION
+	}
+	return path[len(path)-1] == path[len(path)-2]
 }
 
-func (ctr *Chatter) getOptionOrText(path []string, expandingMap *util.ExpandingMap) (*constructs.UserInput, map[int]string, error) {
+func (ctr *Chatter) getOptionOrText(ctx context.Context, path []string, expandingMap *util.ExpandingMap) (*constructs.UserInput, map[int]string, error) {
 	firstVal := constants.DEFAULT_FIRST_OPTION
 
 	if len(path) != 0 {
 		firstVal = path[len(path)-1]
 	}
 
-	options := mapToOptions(expandingMap.ToRegularMap())
+	options := keysToOptions(expandingMap.VisibleKeys())
 	optionsKeys := []int{}
 	for k := range options {
 		optionsKeys = append(optionsKeys, k)
@@ -178,34 +418,54 @@ func (ctr *Chatter) getOptionOrText(path []string, expandingMap *util.ExpandingM
 	sort.Slice(optionsKeys, func(i, j int) bool { return optionsKeys[i] < optionsKeys[j] })
 
 	// Swap default value to beginning.
-	currentFirst := options[optionsKeys[0]]
-	for idx, opt := range optionsKeys {
-		if options[opt] == firstVal {
-			options[optionsKeys[0]] = firstVal
-			options[optionsKeys[idx]] = currentFirst
+	if len(optionsKeys) > 0 {
+		currentFirst := options[optionsKeys[0]]
+		for idx, opt := range optionsKeys {
+			if options[opt] == firstVal {
+				options[optionsKeys[0]] = firstVal
+				options[optionsKeys[idx]] = currentFirst
+			}
 		}
 	}
 
 	userQuery := ""
-	for _, key := range optionsKeys {
-		userQuery += fmt.Sprintf("%d .) %s\n", key, options[key])
+	if len(path) == 0 {
+		status, err := ctr.timerStatus(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("timerStatus() returns err: %w", err)
+		}
+		if status != "" {
+			userQuery += status + "\n\n"
+		}
 	}
-
-	if err := ctr.userMessenger.Send(userQuery); err != nil {
-		return nil, nil, fmt.Errorf("userMessenger.Send() returns err: %w", err)
+	lines, err := ctr.menuLines(ctx, path, expandingMap, options, optionsKeys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("menuLines() returns err: %w", err)
 	}
+	userQuery += lines
 
-	if err := ctr.userMessenger.Send("Choose an option from the list above, or type something new to add it."); err != nil {
-		return nil, nil, fmt.Errorf("userMessenger.Send() returns err: %w", err)
+	if len(options) == 0 {
+		// Everything here is archived, there's nothing to pick, not even by pressing enter.
+		userQuery += fmt.Sprintf("Everything here is archived. Type something new to add it, or %sunarchive to bring an option back.", commandPrefix)
+	} else {
+		userQuery += fmt.Sprintf("\nChoose an option from the list above, or type something new to add it. %shelp lists commands.", commandPrefix)
 	}
 
 	rangeMin := 0
 	rangeMax := len(options) - 1
 
-	userInput, err := ctr.userListener.GetUserInput(
+	userInput, err := ctr.userListener.Ask(
+		ctx,
+		userQuery,
 		ctr.chatterConfig.ResponseWait,
 		ctr.chatterConfig.MaxConfusionRetries,
 		func(ui *constructs.UserInput) error {
+			if len(options) == 0 {
+				if _, err := strconv.Atoi(ui.Text); ui.Text == "" || err == nil {
+					return fmt.Errorf("there are no options to choose from, type a new one or %sunarchive", commandPrefix)
+				}
+				return nil
+			}
 			if digit, err := strconv.Atoi(ui.Text); err == nil {
 				if digit < int(rangeMin) || digit > int(rangeMax) {
 					return fmt.Errorf("input not in range [%d, %d]", rangeMin, rangeMax)
@@ -217,6 +477,7 @@ func (ctr *Chatter) getOptionOrText(path []string, expandingMap *util.ExpandingM
 	if err != nil {
 		return nil, nil, err
 	}
+	atomic.StoreInt32(&ctr.answering, 1)
 
 	if userInput.Text == "" {
 		userInput.Text = "0"
@@ -225,118 +486,133 @@ func (ctr *Chatter) getOptionOrText(path []string, expandingMap *util.ExpandingM
 	return userInput, options, nil
 }
 
-func (ctr *Chatter) recordValue(path []string, value int) error {
-	userData := &constructs.UserData{
-		Data: map[string]interface{}{
-			string(constructs.Activity):     strings.Join(path, "."),
-			string(constructs.MinutesSpent): value,
-		},
-		TimestampMS: time.Now().UnixNano() / int64(time.Millisecond),
-	}
+// annotation is what the user adds to a record besides what they did and when.
+type annotation struct {
+	note string
+	tags []string
+}
 
-	if err := ctr.userDataDAO.Append(userData); err != nil {
-		return fmt.Errorf("userDataDAO.Append() returns err: %w", err)
+// parseAnnotation takes the words of text starting with # as tags and the rest as the note.
+func parseAnnotation(text string) *annotation {
+	ann := &annotation{}
+	words := []string{}
+	for _, word := range strings.Fields(text) {
+		if len(word) > 1 && strings.HasPrefix(word, "#") {
+			ann.tags = append(ann.tags, word)
+		} else {
+			words = append(words, word)
+		}
 	}
-
-	ctr.lastRecordTime = time.Now()
-
-	return nil
+	ann.note = strings.Join(words, " ")
+	return ann
 }
 
-func (ctr *Chatter) getUserSchema() (*constructs.UserSchema, error) {
-	us, err := ctr.userSchemaDAO.Load()
+// askAnnotation asks for a note and tags. Not answering is taken as having
+// none, so the time the user already gave is still recorded.
+func (ctr *Chatter) askAnnotation(ctx context.Context) (*annotation, error) {
+	userInput, err := ctr.ask(ctx, "Any note? Words like #ticket-123 are saved as tags. Enter to skip.", func(*constructs.UserInput) error { return nil })
 	if err != nil {
-		if apperror.IsNotFoundError(err) {
-			if err := ctr.userMessenger.Send(err.Error()); err != nil {
-				return nil, fmt.Errorf("userMessenger.Send returns err: %w", err)
-			}
-
-			if err := ctr.userMessenger.Send("Would you like to create a new schema?"); err != nil {
-				return nil, fmt.Errorf("userMessenger.Send returns err: %w", err)
-			}
-
-			if _, err := ctr.userListener.GetUserInput(
-				ctr.chatterConfig.ResponseWait,
-				0,
-				func(ui *constructs.UserInput) error {
-					if strings.ToUpper(ui.Text) != "YES" {
-						return fmt.Errorf("well then you'll need to create it yourself then")
-					}
-					return nil
-				},
-			); err != nil {
-				return nil, err
-			}
-
-			us, err = ctr.userSchemaDAO.Init()
-			if err != nil {
-				return nil, fmt.Errorf("userSChemaDAO.Init() returns err: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("userSchemaDAO.Load() returns err: %w", err)
+		if apperror.IsTimeoutError(err) || errors.Is(err, io.EOF) {
+			return nil, nil
 		}
+		return nil, err
 	}
 
-	return us, nil
+	return parseAnnotation(userInput.Text), nil
 }
 
-func mapToOptions(subSchema map[string]interface{}) map[int]string {
-	options := map[int]string{}
-	counter := 0
-	for _, key := range util.SortedMapKeysAsc(subSchema) {
-		options[counter] = key
-		counter++
+// recordValue logs path as done over span, once the user agrees to any
+// overlap with what's already logged. ann may be nil.
+func (ctr *Chatter) recordValue(ctx context.Context, path []string, span *util.TimeSpan, ann *annotation) error {
+	ok, err := ctr.confirmOverlaps(ctx, span)
+	if err != nil {
+		return fmt.Errorf("confirmOverlaps() returns err: %w", err)
 	}
-	return options
+	if !ok {
+		return ctr.userMessenger.Send("Not recorded.")
+	}
+
+	return ctr.appendRecord(ctx, path, span, ann)
 }
 
-func (ctr *Chatter) setUpReminders() error {
-	if err := ctr.userMessenger.Send("How often, in minutes, would you like to be reminded to record activity? 0 for never."); err != nil {
-		log.Fatalf("userMessenger.Send() returns err: %v", err)
+// appendRecord logs path as done over span and lets the session undo it. ann may be nil.
+func (ctr *Chatter) appendRecord(ctx context.Context, path []string, span *util.TimeSpan, ann *annotation) error {
+	userData := &constructs.UserData{
+		Data: map[string]interface{}{
+			string(constructs.Activity):     strings.Join(path, "."),
+			string(constructs.MinutesSpent): span.Minutes(),
+		},
+	}
+	userData.SetSpan(span.Start, span.End)
+	if ann != nil {
+		userData.SetNote(ann.note)
+		userData.SetTags(ann.tags)
 	}
 
-	userInput, err := ctr.userListener.GetUserInput(
-		ctr.chatterConfig.ResponseWait,
-		ctr.chatterConfig.MaxConfusionRetries,
-		func(ui *constructs.UserInput) error {
-			if _, err := strconv.Atoi(ui.Text); err != nil {
-				return fmt.Errorf("input must be a digit")
-			}
-			return nil
-		},
-	)
+	if err := ctr.userDataDAO.Append(ctx, userData); err != nil {
+		return fmt.Errorf("userDataDAO.Append() returns err: %w", err)
+	}
 
-	if err != nil {
-		log.Fatalf("user input error: %v", err)
+	ctr.undoStack = append(ctr.undoStack, &sessionRecord{
+		userData:           userData,
+		previousRecordTime: ctr.lastRecordTime,
+	})
+	ctr.redoStack = nil
+
+	// Backfilling the past leaves the next "until now" where it was.
+	if span.End.After(ctr.lastRecordTime) {
+		ctr.lastRecordTime = span.End
 	}
 
-	userDigit, err := strconv.Atoi(userInput.Text)
+	return nil
+}
+
+// confirmOverlaps asks whether to go ahead if span shares time with records
+// already logged, and reports whether to.
+func (ctr *Chatter) confirmOverlaps(ctx context.Context, span *util.TimeSpan) (bool, error) {
+	// Records end at their TimestampMS, so only later ones can overlap.
+	candidates, err := ctr.userDataDAO.List(ctx, &constructs.UserDataFilter{SinceMS: constructs.TimeToMS(span.Start) + 1})
 	if err != nil {
-		log.Fatalf("user input error: %v", err)
+		return false, fmt.Errorf("userDataDAO.List() returns err: %w", err)
 	}
 
-	if userDigit == 0 {
-		return nil
+	question := ""
+	for _, record := range candidates {
+		if record.Overlaps(span.Start, span.End) {
+			question += record.String() + "\n"
+		}
+	}
+	if question == "" {
+		return true, nil
 	}
 
-	triggerReminderLoop(int64(userDigit))
-
-	return nil
+	return ctr.confirm(ctx, fmt.Sprintf("%s-%s overlaps with:\n%sRecord it anyway?", span.Start.Format("15:04"), span.End.Format("15:04"), question))
 }
 
-func triggerReminderLoop(minutesToWait int64) {
-
-	for {
-		time.Sleep(time.Minute * time.Duration(minutesToWait))
+func (ctr *Chatter) getUserSchema(ctx context.Context) (*constructs.UserSchema, error) {
+	us, err := ctr.userSchemaDAO.Load(ctx)
+	if err != nil {
+		if !apperror.IsNotFoundError(err) {
+			return nil, fmt.Errorf("userSchemaDAO.Load() returns err: %w", err)
+		}
 
-		cmd := exec.Command("/bin/sh", "internal/chatter/reminder.bash")
-		if err := cmd.Run(); err != nil {
-			// HACK
-			if strings.Contains(err.Error(), "already started") {
-				continue
-			}
+		if err := ctr.userMessenger.Send("You don't have a schema yet."); err != nil {
+			return nil, fmt.Errorf("userMessenger.Send returns err: %w", err)
+		}
 
-			log.Fatalf("Failed to execute reminder command: %v", err)
+		us, err = ctr.initializer.InitSchema(ctx, ctr.userSchemaDAO)
+		if err != nil {
+			return nil, fmt.Errorf("InitSchema() returns err: %w", err)
 		}
 	}
+
+	return us, nil
+}
+
+func keysToOptions(keys []string) map[int]string {
+	options := map[int]string{}
+	for idx, key := range keys {
+		options[idx] = key
+	}
+	return options
 }
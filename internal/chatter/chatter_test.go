@@ -0,0 +1,177 @@
+package chatter
+
+import (
+	"activity_log/api/constructs"
+	schemadao "activity_log/internal/dao/schema_dao"
+	"activity_log/internal/util"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAnnotation(t *testing.T) {
+	testCases := []struct {
+		desc string
+		text string
+		want *annotation
+	}{
+		{
+			desc: "empty",
+			text: "",
+			want: &annotation{},
+		},
+		{
+			desc: "note only",
+			text: "reviewed the parser",
+			want: &annotation{note: "reviewed the parser"},
+		},
+		{
+			desc: "tags anywhere",
+			text: "#ticket-123 paired on the parser #pairing",
+			want: &annotation{note: "paired on the parser", tags: []string{"#ticket-123", "#pairing"}},
+		},
+		{
+			desc: "lone hash stays in the note",
+			text: "A # B",
+			want: &annotation{note: "A # B"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := parseAnnotation(tc.text); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseAnnotation(%q) returns %+v, want %+v", tc.text, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeStoredSchemaKeepsRenames(t *testing.T) {
+	testCases := []struct {
+		desc string
+		// save brings the round's schema up to date with the stored one.
+		save func(ctr *Chatter, us *constructs.UserSchema) error
+	}{
+		{
+			desc: "reloaded",
+			save: func(ctr *Chatter, us *constructs.UserSchema) error {
+				if err := ctr.reloadSchemaIfChanged(context.Background(), us.Schema); err != nil {
+					return err
+				}
+				return ctr.dumpSchema(context.Background(), us)
+			},
+		},
+		{
+			desc: "dumped over a conflict",
+			save: func(ctr *Chatter, us *constructs.UserSchema) error {
+				return ctr.dumpSchema(context.Background(), us)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schema.json")
+			initial, err := util.NewExpandingMap(map[string]interface{}{
+				"default": nil,
+				"working": map[string]interface{}{
+					"coding":  nil,
+					"meeting": nil,
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewExpandingMap() returns err: %v", err)
+			}
+			if err := schemadao.NewLocalSchemaDAO(path, 0).Dump(context.Background(), &constructs.UserSchema{Schema: initial}, true); err != nil {
+				t.Fatalf("Dump() returns err: %v", err)
+			}
+
+			ctr := &Chatter{userSchemaDAO: schemadao.NewLocalSchemaDAO(path, 0)}
+			us, err := ctr.userSchemaDAO.Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load() returns err: %v", err)
+			}
+			ctr.schemaBase = us.Schema.Copy()
+
+			// The user adds an option while another process renames working.
+			if err := us.Schema.AddSubMap([]string{"working"}, "review"); err != nil {
+				t.Fatalf("AddSubMap() returns err: %v", err)
+			}
+			if err := us.Schema.AddSubMap(nil, "reading"); err != nil {
+				t.Fatalf("AddSubMap() returns err: %v", err)
+			}
+			other := schemadao.NewLocalSchemaDAO(path, 0)
+			theirs, err := other.Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load() returns err: %v", err)
+			}
+			if err := theirs.Schema.Rename([]string{"working"}, "work"); err != nil {
+				t.Fatalf("Rename() returns err: %v", err)
+			}
+			if err := other.Dump(context.Background(), theirs, false); err != nil {
+				t.Fatalf("Dump() returns err: %v", err)
+			}
+
+			if err := tc.save(ctr, us); err != nil {
+				t.Fatalf("saving the round returns err: %v", err)
+			}
+
+			stored, err := schemadao.NewLocalSchemaDAO(path, 0).Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load() returns err: %v", err)
+			}
+			// The option added under working goes with it, the one at the top stays.
+			want := map[string]interface{}{
+				"default": nil,
+				"work": map[string]interface{}{
+					"coding":  nil,
+					"meeting": nil,
+				},
+				"reading": nil,
+			}
+			for name, got := range map[string]map[string]interface{}{"menu": us.Schema.ToRegularMap(), "stored": stored.Schema.ToRegularMap()} {
+				if err := util.NestedMapsEqual(want, got); err != nil {
+					t.Errorf("%s schema: want %+v, got %+v, err: %v", name, want, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetOptionOrTextAllArchived(t *testing.T) {
+	// Enter and a number have nothing to pick, so only the new option is taken.
+	ctr, _, out := newTestChatter(t, "", "0", "reviewing")
+	ctr.chatterConfig.MaxConfusionRetries = 2
+
+	schema, err := util.NewExpandingMap(map[string]interface{}{
+		"working": map[string]interface{}{
+			"coding":  nil,
+			"meeting": nil,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewExpandingMap() returns err: %v", err)
+	}
+	for _, key := range []string{"coding", "meeting"} {
+		if err := schema.SetMeta([]string{"working", key}, util.NodeMeta{Archived: true}); err != nil {
+			t.Fatalf("SetMeta() returns err: %v", err)
+		}
+	}
+	working, err := schema.GetSubMap([]string{"working"})
+	if err != nil {
+		t.Fatalf("GetSubMap() returns err: %v", err)
+	}
+
+	userInput, options, err := ctr.getOptionOrText(context.Background(), []string{"working"}, working)
+	if err != nil {
+		t.Fatalf("getOptionOrText() returns err: %v", err)
+	}
+	if userInput.Text != "reviewing" || len(options) != 0 {
+		t.Errorf("getOptionOrText() returns %q, %v, want %q and no options", userInput.Text, options, "reviewing")
+	}
+	if !strings.Contains(out.String(), "Everything here is archived") {
+		t.Errorf("getOptionOrText() says %q, want it to say everything is archived", out.String())
+	}
+}
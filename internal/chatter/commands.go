@@ -0,0 +1,420 @@
+package chatter
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commandPrefix marks option prompt input as a command rather than a new option.
+const commandPrefix = ":"
+
+// recentRecordCount is how many records commands offer to pick from.
+const recentRecordCount = 10
+
+type command struct {
+	help string
+	run  func(ctx context.Context, schema *util.ExpandingMap, args []string) error
+}
+
+func (ctr *Chatter) commands() map[string]*command {
+	return map[string]*command{
+		"help": {
+			help: "List the available commands.",
+			run:  ctr.printHelp,
+		},
+		"edit": {
+			help: "Change the minutes or activity of a recent record.",
+			run:  ctr.editRecord,
+		},
+		"delete": {
+			help: "Delete a recent record.",
+			run:  ctr.deleteRecord,
+		},
+		"undo": {
+			help: "Take back the last record made this session.",
+			run:  ctr.undo,
+		},
+		"redo": {
+			help: "Record again what the last undo took back.",
+			run:  ctr.redo,
+		},
+		"backfill": {
+			help: "Record an activity you forgot to log at the time.",
+			run:  ctr.backfill,
+		},
+		"start": {
+			help: "Start timing an activity, picked from the menu or named, e.g. :start working.coding.",
+			run:  ctr.startTimer,
+		},
+		"stop": {
+			help: "Stop the timer and record the time it ran.",
+			run:  ctr.stopTimer,
+		},
+		"switch": {
+			help: "Stop the timer and start timing another activity from the same moment.",
+			run:  ctr.switchTimer,
+		},
+		"snooze": {
+			help: "No reminders for the given minutes, e.g. :snooze 15. \"remind me in 15\" works too.",
+			run:  ctr.snooze,
+		},
+		"rename": {
+			help: "Rename an activity and the records logged against it, e.g. :rename working.reconciling_bad_code refactoring.",
+			run:  ctr.renameActivity,
+		},
+		"move": {
+			help: "Move an activity and its records under another, e.g. :move SideProject working, or to the top with :move working.SideProject .",
+			run:  ctr.moveActivity,
+		},
+		"merge": {
+			help: "Merge an activity and its records into another, e.g. :merge working.meetings working.meeting.",
+			run:  ctr.mergeActivity,
+		},
+		"remove": {
+			help: "Remove an activity from your schema, moving its records to another if named, e.g. :remove working.meeting working.",
+			run:  ctr.removeActivity,
+		},
+		"archive": {
+			help: "Hide an activity from the menu, keeping its records for reports, e.g. :archive SideProject.",
+			run:  ctr.archiveActivity,
+		},
+		"unarchive": {
+			help: "Put an archived activity back in the menu, picked from a list or named.",
+			run:  ctr.unarchiveActivity,
+		},
+		"reminders": {
+			help: "Change when you're reminded to log.",
+			run:  ctr.changeReminders,
+		},
+	}
+}
+
+// snoozeRequest is asking for a snooze in plain words, e.g. "remind me in 15 minutes".
+var snoozeRequest = regexp.MustCompile(`^remind me in (\d+)(?: ?(?:m|min|mins|minute|minutes))?$`)
+
+// asCommand returns the command text is, if it's one.
+func asCommand(text string) (string, bool) {
+	if strings.HasPrefix(text, commandPrefix) {
+		return text, true
+	}
+
+	if match := snoozeRequest.FindStringSubmatch(strings.ToLower(text)); match != nil {
+		return fmt.Sprintf("%ssnooze %s", commandPrefix, match[1]), true
+	}
+
+	return "", false
+}
+
+func (ctr *Chatter) runCommand(ctx context.Context, text string, schema *util.ExpandingMap) error {
+	fields := strings.Fields(strings.TrimPrefix(text, commandPrefix))
+	if len(fields) == 0 {
+		return fmt.Errorf("missing command, %shelp lists commands", commandPrefix)
+	}
+
+	cmd, ok := ctr.commands()[fields[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, %shelp lists commands", text, commandPrefix)
+	}
+
+	return cmd.run(ctx, schema, fields[1:])
+}
+
+func (ctr *Chatter) printHelp(_ context.Context, _ *util.ExpandingMap, _ []string) error {
+	cmds := ctr.commands()
+
+	names := []string{}
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msg := ""
+	for _, name := range names {
+		msg += fmt.Sprintf("%s%s -- %s\n", commandPrefix, name, cmds[name].help)
+	}
+
+	return ctr.userMessenger.Send(msg)
+}
+
+func (ctr *Chatter) editRecord(ctx context.Context, schema *util.ExpandingMap, _ []string) error {
+	record, err := ctr.chooseRecentRecord(ctx, "Which record would you like to edit?")
+	if err != nil {
+		return fmt.Errorf("chooseRecentRecord() returns err: %w", err)
+	}
+
+	minutes, err := record.Minutes()
+	if err != nil {
+		return fmt.Errorf("Minutes() returns err: %w", err)
+	}
+
+	// Lengths keep the record's end, ranges of times move it.
+	userInput, err := ctr.ask(
+		ctx,
+		fmt.Sprintf("How many minutes, or when, e.g. 10:00-11:00? Enter to keep %d.", minutes),
+		func(ui *constructs.UserInput) error {
+			if ui.Text == "" {
+				return nil
+			}
+			_, err := editedSpan(ui.Text, record)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	var span *util.TimeSpan
+	if userInput.Text != "" {
+		span, err = editedSpan(userInput.Text, record)
+		if err != nil {
+			return fmt.Errorf("editedSpan(%s) returns err: %w", userInput.Text, err)
+		}
+		minutes = span.Minutes()
+	}
+
+	userInput, err = ctr.ask(
+		ctx,
+		fmt.Sprintf("Which activity? Enter to keep %s.", record.ActivityPath()),
+		func(ui *constructs.UserInput) error {
+			if ui.Text == "" {
+				return nil
+			}
+			if _, err := schema.GetSubMap(strings.Split(ui.Text, ".")); err != nil {
+				return fmt.Errorf("%q is not in your schema", ui.Text)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	record.Data[string(constructs.MinutesSpent)] = minutes
+	if span != nil {
+		record.SetSpan(span.Start, span.End)
+	}
+	if userInput.Text != "" {
+		record.Data[string(constructs.Activity)] = userInput.Text
+	}
+
+	if err := ctr.userDataDAO.Update(ctx, record); err != nil {
+		return fmt.Errorf("userDataDAO.Update() returns err: %w", err)
+	}
+
+	return ctr.userMessenger.Send(fmt.Sprintf("Updated: %s", record.String()))
+}
+
+// editedSpan reads a new span for record. Lengths keep the record's end, ranges
+// of times are on the record's day and may end after it, just not in the future.
+func editedSpan(text string, record *constructs.UserData) (*util.TimeSpan, error) {
+	if !util.IsClockRange(text) {
+		return util.ParseTimeSpan(text, record.End(), record.Start())
+	}
+
+	span, err := util.ParseClockRange(text, record.End())
+	if err != nil {
+		return nil, err
+	}
+	if span.End.After(time.Now()) {
+		return nil, apperror.NewUserConfusedError(fmt.Errorf("%q hasn't happened yet", text))
+	}
+	return span, nil
+}
+
+func (ctr *Chatter) deleteRecord(ctx context.Context, _ *util.ExpandingMap, _ []string) error {
+	record, err := ctr.chooseRecentRecord(ctx, "Which record would you like to delete?")
+	if err != nil {
+		return fmt.Errorf("chooseRecentRecord() returns err: %w", err)
+	}
+
+	confirmed, err := ctr.confirm(ctx, fmt.Sprintf("Delete %s?", record.String()))
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return nil
+	}
+
+	if err := ctr.userDataDAO.Delete(ctx, record.ID); err != nil {
+		return fmt.Errorf("userDataDAO.Delete() returns err: %w", err)
+	}
+
+	return ctr.userMessenger.Send(fmt.Sprintf("Deleted: %s", record.String()))
+}
+
+func (ctr *Chatter) undo(ctx context.Context, _ *util.ExpandingMap, _ []string) error {
+	if len(ctr.undoStack) == 0 {
+		return fmt.Errorf("nothing has been recorded this session")
+	}
+	last := ctr.undoStack[len(ctr.undoStack)-1]
+
+	confirmed, err := ctr.confirm(ctx, fmt.Sprintf("Undo %s?", last.userData.String()))
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return nil
+	}
+
+	err = ctr.userDataDAO.Delete(ctx, last.userData.ID)
+	if apperror.IsNotFoundError(err) {
+		// Deleted some other way, there's nothing left to undo or redo.
+		ctr.undoStack = ctr.undoStack[:len(ctr.undoStack)-1]
+		return ctr.userMessenger.Send(fmt.Sprintf("Already gone: %s", last.userData.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("userDataDAO.Delete() returns err: %w", err)
+	}
+
+	ctr.undoStack = ctr.undoStack[:len(ctr.undoStack)-1]
+	ctr.redoStack = append(ctr.redoStack, last)
+	ctr.lastRecordTime = last.previousRecordTime
+
+	return ctr.userMessenger.Send(fmt.Sprintf("Undone: %s", last.userData.String()))
+}
+
+func (ctr *Chatter) redo(ctx context.Context, _ *util.ExpandingMap, _ []string) error {
+	if len(ctr.redoStack) == 0 {
+		return fmt.Errorf("nothing has been undone this session")
+	}
+	last := ctr.redoStack[len(ctr.redoStack)-1]
+
+	if err := ctr.userDataDAO.Append(ctx, last.userData); err != nil {
+		return fmt.Errorf("userDataDAO.Append() returns err: %w", err)
+	}
+
+	ctr.redoStack = ctr.redoStack[:len(ctr.redoStack)-1]
+	ctr.undoStack = append(ctr.undoStack, &sessionRecord{
+		userData:           last.userData,
+		previousRecordTime: ctr.lastRecordTime,
+	})
+	if last.userData.End().After(ctr.lastRecordTime) {
+		ctr.lastRecordTime = last.userData.End()
+	}
+
+	return ctr.userMessenger.Send(fmt.Sprintf("Redone: %s", last.userData.String()))
+}
+
+// backfill records an activity at a time in the past.
+func (ctr *Chatter) backfill(ctx context.Context, schema *util.ExpandingMap, _ []string) error {
+	userInput, err := ctr.ask(ctx, "Which activity? E.g. working.meeting", func(ui *constructs.UserInput) error {
+		if ui.Text == "" {
+			return fmt.Errorf("please name an activity")
+		}
+		if _, err := schema.GetSubMap(strings.Split(ui.Text, ".")); err != nil {
+			return fmt.Errorf("%q is not in your schema", ui.Text)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	path := strings.Split(userInput.Text, ".")
+
+	userInput, err = ctr.ask(ctx, "Which day? Enter for today, yesterday or YYYY-MM-DD.", func(ui *constructs.UserInput) error {
+		_, err := util.ParseDay(ui.Text, time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	day, err := util.ParseDay(userInput.Text, time.Now())
+	if err != nil {
+		return fmt.Errorf("ParseDay(%s) returns err: %w", userInput.Text, err)
+	}
+
+	userInput, err = ctr.ask(ctx, "When? E.g. 10:00-11:00.", func(ui *constructs.UserInput) error {
+		span, err := util.ParseClockRange(ui.Text, day)
+		if err != nil {
+			return err
+		}
+		if span.End.After(time.Now()) {
+			return apperror.NewUserConfusedError(fmt.Errorf("%q hasn't happened yet", ui.Text))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	span, err := util.ParseClockRange(userInput.Text, day)
+	if err != nil {
+		return fmt.Errorf("ParseClockRange(%s) returns err: %w", userInput.Text, err)
+	}
+
+	ann, err := ctr.askAnnotation(ctx)
+	if err != nil {
+		return fmt.Errorf("askAnnotation() returns err: %w", err)
+	}
+
+	if err := ctr.recordValue(ctx, path, span, ann); err != nil {
+		return fmt.Errorf("recordValue() returns err: %w", err)
+	}
+
+	return nil
+}
+
+func (ctr *Chatter) chooseRecentRecord(ctx context.Context, question string) (*constructs.UserData, error) {
+	records, err := ctr.userDataDAO.List(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("userDataDAO.List() returns err: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("nothing has been recorded yet")
+	}
+
+	if len(records) > recentRecordCount {
+		records = records[len(records)-recentRecordCount:]
+	}
+
+	query := ""
+	for idx, record := range records {
+		query += fmt.Sprintf("%d .) %s\n", idx, record.String())
+	}
+	userInput, err := ctr.ask(ctx, query+"\n"+question, func(ui *constructs.UserInput) error {
+		digit, err := strconv.Atoi(ui.Text)
+		if err != nil || digit < 0 || digit >= len(records) {
+			return fmt.Errorf("input not in range [%d, %d]", 0, len(records)-1)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digit, _ := strconv.Atoi(userInput.Text)
+	return records[digit], nil
+}
+
+func (ctr *Chatter) confirm(ctx context.Context, question string) (bool, error) {
+	userInput, err := ctr.ask(ctx, fmt.Sprintf("%s (yes/no)", question), func(ui *constructs.UserInput) error {
+		switch strings.ToUpper(ui.Text) {
+		case "YES", "NO":
+			return nil
+		default:
+			return fmt.Errorf("please answer yes or no")
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return strings.ToUpper(userInput.Text) == "YES", nil
+}
+
+func (ctr *Chatter) ask(ctx context.Context, question string, invariants func(*constructs.UserInput) error) (*constructs.UserInput, error) {
+	return ctr.userListener.Ask(
+		ctx,
+		question,
+		ctr.chatterConfig.ResponseWait,
+		ctr.chatterConfig.MaxConfusionRetries,
+		invariants,
+	)
+}
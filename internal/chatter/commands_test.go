@@ -0,0 +1,238 @@
+package chatter
+
+import (
+	"activity_log/api/constructs"
+	datadao "activity_log/internal/dao/data_dao"
+	"activity_log/internal/user_input"
+	"activity_log/internal/user_output"
+	"activity_log/internal/util"
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsCommand(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		text   string
+		want   string
+		wantOK bool
+	}{
+		{
+			desc:   "prefixed",
+			text:   ":snooze 15",
+			want:   ":snooze 15",
+			wantOK: true,
+		},
+		{
+			desc:   "snooze in plain words",
+			text:   "Remind me in 15",
+			want:   ":snooze 15",
+			wantOK: true,
+		},
+		{
+			desc:   "snooze with a unit",
+			text:   "remind me in 20 minutes",
+			want:   ":snooze 20",
+			wantOK: true,
+		},
+		{
+			desc: "new option",
+			text: "reading",
+		},
+		{
+			desc: "snooze without minutes",
+			text: "remind me in a bit",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, ok := asCommand(tc.text)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("asCommand(%q) = %q, %v, want %q, %v", tc.text, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+// fakeListener answers prompts with the scripted lines, then with io.EOF.
+type fakeListener struct {
+	lines []string
+}
+
+func (fl *fakeListener) GetUserInput(_ context.Context, _ time.Duration) (*constructs.UserInput, error) {
+	if len(fl.lines) == 0 {
+		return nil, io.EOF
+	}
+	line := fl.lines[0]
+	fl.lines = fl.lines[1:]
+	return &constructs.UserInput{Text: line}, nil
+}
+
+// newTestChatter returns a Chatter over an empty data file, answering its
+// prompts with lines, and what it says to the user.
+func newTestChatter(t *testing.T, lines ...string) (*Chatter, *datadao.DataDAO, *bytes.Buffer) {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	messenger := user_output.NewUserMessenger(out)
+	listener := user_input.New(&fakeListener{lines: lines}, messenger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		listener.Serve(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	dataDAO := datadao.NewDataDAO(filepath.Join(t.TempDir(), "data.csv"))
+	ctr := NewChatter(listener, messenger, nil, dataDAO, nil, nil, nil, &ChatterConfig{})
+	return ctr, dataDAO, out
+}
+
+// appendTestRecord records minutes of activity ending an hour ago.
+func appendTestRecord(t *testing.T, ctr *Chatter, activity string, minutes int) {
+	t.Helper()
+
+	end := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	span := &util.TimeSpan{Start: end.Add(-time.Duration(minutes) * time.Minute), End: end}
+	if err := ctr.appendRecord(context.Background(), []string{activity}, span, nil); err != nil {
+		t.Fatalf("appendRecord() returns err: %v", err)
+	}
+}
+
+func listRecords(t *testing.T, dataDAO *datadao.DataDAO) []*constructs.UserData {
+	t.Helper()
+
+	records, err := dataDAO.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	return records
+}
+
+func TestUndoRedo(t *testing.T) {
+	ctr, dataDAO, _ := newTestChatter(t, "yes")
+	previous := time.Now().Add(-3 * time.Hour).Truncate(time.Minute)
+	ctr.lastRecordTime = previous
+	appendTestRecord(t, ctr, "reading", 30)
+	end := listRecords(t, dataDAO)[0].End()
+	if !ctr.lastRecordTime.Equal(end) {
+		t.Fatalf("lastRecordTime after the record: got %v, want its end %v", ctr.lastRecordTime, end)
+	}
+
+	if err := ctr.runCommand(context.Background(), ":undo", nil); err != nil {
+		t.Fatalf("runCommand(:undo) returns err: %v", err)
+	}
+	if got := listRecords(t, dataDAO); len(got) != 0 {
+		t.Fatalf("records after undo: got %d, want 0", len(got))
+	}
+	// The next round starts where the record before the undone one ended.
+	if !ctr.lastRecordTime.Equal(previous) {
+		t.Errorf("lastRecordTime after undo: got %v, want %v", ctr.lastRecordTime, previous)
+	}
+
+	if err := ctr.runCommand(context.Background(), ":redo", nil); err != nil {
+		t.Fatalf("runCommand(:redo) returns err: %v", err)
+	}
+	got := listRecords(t, dataDAO)
+	if len(got) != 1 || got[0].ActivityPath() != "reading" {
+		t.Fatalf("records after redo: got %+v, want the reading record", got)
+	}
+	if !ctr.lastRecordTime.Equal(end) {
+		t.Errorf("lastRecordTime after redo: got %v, want the restored record's end %v", ctr.lastRecordTime, end)
+	}
+
+	if err := ctr.runCommand(context.Background(), ":redo", nil); err == nil {
+		t.Errorf("runCommand(:redo) with nothing undone returns nil, want an error")
+	}
+}
+
+func TestUndoAlreadyDeleted(t *testing.T) {
+	ctr, dataDAO, out := newTestChatter(t, "yes")
+	appendTestRecord(t, ctr, "reading", 30)
+
+	records := listRecords(t, dataDAO)
+	if err := dataDAO.Delete(context.Background(), records[0].ID); err != nil {
+		t.Fatalf("Delete() returns err: %v", err)
+	}
+
+	if err := ctr.runCommand(context.Background(), ":undo", nil); err != nil {
+		t.Fatalf("runCommand(:undo) returns err: %v", err)
+	}
+	if !strings.Contains(out.String(), "Already gone") {
+		t.Errorf("undo of a deleted record says %q, want it to say it's already gone", out.String())
+	}
+
+	// Nothing is left to undo or redo.
+	if err := ctr.runCommand(context.Background(), ":undo", nil); err == nil {
+		t.Errorf("runCommand(:undo) a second time returns nil, want an error")
+	}
+	if err := ctr.runCommand(context.Background(), ":redo", nil); err == nil {
+		t.Errorf("runCommand(:redo) returns nil, want an error")
+	}
+}
+
+func TestEditRecord(t *testing.T) {
+	// Pick the record, change its length and keep its activity.
+	ctr, dataDAO, _ := newTestChatter(t, "0", "45", "")
+	appendTestRecord(t, ctr, "reading", 30)
+	before := listRecords(t, dataDAO)[0]
+
+	if err := ctr.runCommand(context.Background(), ":edit", nil); err != nil {
+		t.Fatalf("runCommand(:edit) returns err: %v", err)
+	}
+
+	got := listRecords(t, dataDAO)
+	if len(got) != 1 {
+		t.Fatalf("records after edit: got %d, want 1", len(got))
+	}
+	if minutes, err := got[0].Minutes(); err != nil || minutes != 45 {
+		t.Errorf("Minutes() after edit = %d, %v, want 45", minutes, err)
+	}
+	if got[0].ActivityPath() != "reading" || !got[0].End().Equal(before.End()) {
+		t.Errorf("edit changed %+v to %+v, want the same activity and end", before, got[0])
+	}
+}
+
+func TestDeleteRecord(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		confirm     string
+		wantRecords int
+	}{
+		{
+			desc:        "confirmed",
+			confirm:     "yes",
+			wantRecords: 0,
+		},
+		{
+			desc:        "declined",
+			confirm:     "no",
+			wantRecords: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctr, dataDAO, _ := newTestChatter(t, "0", tc.confirm)
+			appendTestRecord(t, ctr, "reading", 30)
+
+			if err := ctr.runCommand(context.Background(), ":delete", nil); err != nil {
+				t.Fatalf("runCommand(:delete) returns err: %v", err)
+			}
+			if got := listRecords(t, dataDAO); len(got) != tc.wantRecords {
+				t.Errorf("records after delete: got %d, want %d", len(got), tc.wantRecords)
+			}
+		})
+	}
+}
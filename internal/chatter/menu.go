@@ -0,0 +1,110 @@
+package chatter
+
+import (
+	"activity_log/api/constructs"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ansiColors are the terminal escape codes of util.NodeColors.
+var ansiColors = map[string]string{
+	"red":     "\033[31m",
+	"green":   "\033[32m",
+	"yellow":  "\033[33m",
+	"blue":    "\033[34m",
+	"magenta": "\033[35m",
+	"cyan":    "\033[36m",
+}
+
+const ansiReset = "\033[0m"
+
+// loggedMinutes is how long was logged today and this week against each
+// activity, counting everything under it.
+type loggedMinutes struct {
+	today map[string]int
+	week  map[string]int
+}
+
+// loadLoggedMinutes adds up what was logged since the start of the week of now.
+func (ctr *Chatter) loadLoggedMinutes(ctx context.Context, now time.Time) (*loggedMinutes, error) {
+	records, err := ctr.userDataDAO.List(ctx, &constructs.UserDataFilter{SinceMS: constructs.TimeToMS(util.StartOfWeek(now))})
+	if err != nil {
+		return nil, fmt.Errorf("userDataDAO.List() returns err: %w", err)
+	}
+
+	logged := &loggedMinutes{today: map[string]int{}, week: map[string]int{}}
+	startOfDay := util.StartOfDay(now)
+	for _, record := range records {
+		minutes, err := record.Minutes()
+		if err != nil {
+			continue
+		}
+		path := strings.Split(record.ActivityPath(), ".")
+		for idx := range path {
+			activity := strings.Join(path[:idx+1], ".")
+			logged.week[activity] += minutes
+			if !record.Start().Before(startOfDay) {
+				logged.today[activity] += minutes
+			}
+		}
+	}
+
+	return logged, nil
+}
+
+// menuLines lists options, the keys under path, each in its color and with
+// its description and how far along its targets are.
+func (ctr *Chatter) menuLines(ctx context.Context, path []string, expandingMap *util.ExpandingMap, options map[int]string, optionsKeys []int) (string, error) {
+	metas := map[int]util.NodeMeta{}
+	hasTargets := false
+	for _, key := range optionsKeys {
+		subMap, err := expandingMap.GetSubMap([]string{options[key]})
+		if err != nil {
+			return "", fmt.Errorf("GetSubMap(%s) returns err: %w", options[key], err)
+		}
+		metas[key] = subMap.Meta()
+		hasTargets = hasTargets || metas[key].DailyTargetMinutes > 0 || metas[key].WeeklyTargetMinutes > 0
+	}
+
+	var logged *loggedMinutes
+	if hasTargets {
+		var err error
+		if logged, err = ctr.loadLoggedMinutes(ctx, time.Now()); err != nil {
+			return "", fmt.Errorf("loadLoggedMinutes() returns err: %w", err)
+		}
+	}
+
+	lines := ""
+	for _, key := range optionsKeys {
+		activity := strings.Join(append(append([]string{}, path...), options[key]), ".")
+		lines += fmt.Sprintf("%d .) %s\n", key, ctr.describeOption(options[key], activity, metas[key], logged))
+	}
+	return lines, nil
+}
+
+// describeOption is name as it's listed in the menu.
+func (ctr *Chatter) describeOption(name string, activity string, meta util.NodeMeta, logged *loggedMinutes) string {
+	text := name
+	if code, ok := ansiColors[meta.Color]; ok && ctr.chatterConfig.Color {
+		text = code + name + ansiReset
+	}
+	if meta.Description != "" {
+		text += " -- " + meta.Description
+	}
+
+	progress := []string{}
+	if meta.DailyTargetMinutes > 0 {
+		progress = append(progress, fmt.Sprintf("%s of %s today", util.FormatMinutes(logged.today[activity]), util.FormatMinutes(meta.DailyTargetMinutes)))
+	}
+	if meta.WeeklyTargetMinutes > 0 {
+		progress = append(progress, fmt.Sprintf("%s of %s this week", util.FormatMinutes(logged.week[activity]), util.FormatMinutes(meta.WeeklyTargetMinutes)))
+	}
+	if len(progress) > 0 {
+		text += fmt.Sprintf(" (%s)", strings.Join(progress, ", "))
+	}
+
+	return text
+}
@@ -1 +0,0 @@
-osascript -e 'tell app "System Events" to display dialog "Reminder to log activity!"'
@@ -0,0 +1,164 @@
+package chatter
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	"activity_log/internal/reminder"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// setUpReminders starts reminding the user in the background, on the
+// configured or saved schedule or, the first time, on one they're asked for.
+func (ctr *Chatter) setUpReminders(ctx context.Context) error {
+	schedule, err := ctr.savedSchedule()
+	if err != nil && !apperror.IsNotFoundError(err) {
+		return fmt.Errorf("savedSchedule() returns err: %w", err)
+	}
+
+	if apperror.IsNotFoundError(err) {
+		schedule, err = ctr.askSchedule(ctx)
+		if apperror.IsTimeoutError(err) {
+			if err := ctr.userMessenger.Send("No answer, you won't be reminded this session."); err != nil {
+				return fmt.Errorf("userMessenger.Send() returns err: %w", err)
+			}
+			schedule = &reminder.Schedule{}
+		} else if err != nil {
+			return fmt.Errorf("askSchedule() returns err: %w", err)
+		} else if err := ctr.saveSchedule(schedule); err != nil {
+			return fmt.Errorf("saveSchedule() returns err: %w", err)
+		}
+	} else {
+		msg := fmt.Sprintf("Reminders: %s. %sreminders changes them.", schedule, commandPrefix)
+		if err := ctr.userMessenger.Send(msg); err != nil {
+			return fmt.Errorf("userMessenger.Send() returns err: %w", err)
+		}
+	}
+
+	ctr.scheduler = reminder.NewScheduler(
+		schedule,
+		reminder.RealClock{},
+		ctr.notifier,
+		func() bool { return atomic.LoadInt32(&ctr.answering) == 1 },
+		func(err error) {
+			ctr.userMessenger.Send(fmt.Sprintf("ERROR: couldn't send a reminder: %v", err))
+		},
+	)
+	go ctr.scheduler.Run(ctx)
+
+	return nil
+}
+
+// savedSchedule is the configured schedule, or else the one saved at ReminderSettingsPath.
+func (ctr *Chatter) savedSchedule() (*reminder.Schedule, error) {
+	if ctr.chatterConfig.ReminderSchedule != "" {
+		schedule, err := reminder.ParseSchedule(ctr.chatterConfig.ReminderSchedule)
+		if err != nil {
+			return nil, fmt.Errorf("configured reminder schedule: %w", err)
+		}
+		return schedule, nil
+	}
+
+	settings, err := reminder.LoadSettings(ctr.chatterConfig.ReminderSettingsPath)
+	if err != nil {
+		return nil, fmt.Errorf("reminder.LoadSettings() returns err: %w", err)
+	}
+
+	schedule, err := settings.ParsedSchedule()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ctr.chatterConfig.ReminderSettingsPath, err)
+	}
+
+	return schedule, nil
+}
+
+// askSchedule asks when to remind the user.
+func (ctr *Chatter) askSchedule(ctx context.Context) (*reminder.Schedule, error) {
+	userInput, err := ctr.ask(
+		ctx,
+		"When would you like to be reminded to record activity? "+
+			"E.g. \"every 30 minutes, 9:00-18:00, Mon-Fri\", \"every 45 minutes\" or \"never\".",
+		func(ui *constructs.UserInput) error {
+			_, err := reminder.ParseSchedule(ui.Text)
+			return err
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := reminder.ParseSchedule(userInput.Text)
+	if err != nil {
+		return nil, fmt.Errorf("reminder.ParseSchedule(%s) returns err: %w", userInput.Text, err)
+	}
+
+	return schedule, nil
+}
+
+func (ctr *Chatter) saveSchedule(schedule *reminder.Schedule) error {
+	settings := &reminder.Settings{Schedule: schedule.String()}
+	if err := reminder.SaveSettings(ctr.chatterConfig.ReminderSettingsPath, settings); err != nil {
+		return fmt.Errorf("reminder.SaveSettings() returns err: %w", err)
+	}
+
+	return nil
+}
+
+func (ctr *Chatter) changeReminders(ctx context.Context, _ *util.ExpandingMap, _ []string) error {
+	if ctr.scheduler == nil {
+		return fmt.Errorf("reminders aren't running")
+	}
+
+	schedule, err := ctr.askSchedule(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctr.scheduler.SetSchedule(schedule)
+
+	// The configured schedule would win over a saved one next time anyway.
+	if ctr.chatterConfig.ReminderSchedule != "" {
+		return ctr.userMessenger.Send(fmt.Sprintf("Reminders: %s, for this session. Your config sets them after that.", schedule))
+	}
+
+	if err := ctr.saveSchedule(schedule); err != nil {
+		return fmt.Errorf("saveSchedule() returns err: %w", err)
+	}
+
+	return ctr.userMessenger.Send(fmt.Sprintf("Reminders: %s.", schedule))
+}
+
+func (ctr *Chatter) snooze(ctx context.Context, _ *util.ExpandingMap, args []string) error {
+	if ctr.scheduler == nil {
+		return fmt.Errorf("reminders aren't running")
+	}
+
+	text := ""
+	if len(args) > 0 {
+		text = args[0]
+	} else {
+		userInput, err := ctr.ask(ctx, "For how many minutes?", func(ui *constructs.UserInput) error {
+			if minutes, err := strconv.Atoi(ui.Text); err != nil || minutes <= 0 {
+				return fmt.Errorf("input must be a positive digit")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		text = userInput.Text
+	}
+
+	minutes, err := strconv.Atoi(text)
+	if err != nil || minutes <= 0 {
+		return fmt.Errorf("%q isn't a positive number of minutes", text)
+	}
+
+	ctr.scheduler.Snooze(time.Duration(minutes) * time.Minute)
+
+	return ctr.userMessenger.Send(fmt.Sprintf("No reminders until %s.", time.Now().Add(time.Duration(minutes)*time.Minute).Format("15:04")))
+}
@@ -0,0 +1,156 @@
+package chatter
+
+import (
+	"activity_log/api/constructs"
+	"activity_log/internal/schemaedit"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// renameActivity renames an activity, e.g. :rename working.reconciling_bad_code refactoring.
+func (ctr *Chatter) renameActivity(ctx context.Context, schema *util.ExpandingMap, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %srename <activity> <new-name>", commandPrefix)
+	}
+
+	edit, err := schemaedit.Rename(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return ctr.editSchema(ctx, schema, edit)
+}
+
+// moveActivity moves an activity under another, e.g. :move SideProject
+// working, or to the top with :move working.SideProject .
+func (ctr *Chatter) moveActivity(ctx context.Context, schema *util.ExpandingMap, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %smove <activity> <new-parent|%s>", commandPrefix, schemaedit.TopLevel)
+	}
+
+	edit, err := schemaedit.Move(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return ctr.editSchema(ctx, schema, edit)
+}
+
+// mergeActivity folds an activity into another, e.g. :merge working.meetings working.meeting.
+func (ctr *Chatter) mergeActivity(ctx context.Context, schema *util.ExpandingMap, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %smerge <activity> <into>", commandPrefix)
+	}
+
+	edit, err := schemaedit.Merge(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return ctr.editSchema(ctx, schema, edit)
+}
+
+// removeActivity deletes an activity from the schema, moving its records
+// to another if one is named, e.g. :remove working.meeting working.
+func (ctr *Chatter) removeActivity(ctx context.Context, schema *util.ExpandingMap, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return fmt.Errorf("usage: %sremove <activity> [activity to move its records to]", commandPrefix)
+	}
+
+	recordsTo := ""
+	if len(args) == 2 {
+		recordsTo = args[1]
+	}
+	edit, err := schemaedit.Delete(args[0], recordsTo)
+	if err != nil {
+		return err
+	}
+	return ctr.editSchema(ctx, schema, edit)
+}
+
+// archiveActivity hides an activity from the menu, keeping its records, e.g. :archive SideProject.
+func (ctr *Chatter) archiveActivity(ctx context.Context, schema *util.ExpandingMap, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %sarchive <activity>", commandPrefix)
+	}
+
+	edit, err := schemaedit.Archive(args[0])
+	if err != nil {
+		return err
+	}
+	return ctr.editSchema(ctx, schema, edit)
+}
+
+// unarchiveActivity puts an archived activity back in the menu, asking
+// which if none is named.
+func (ctr *Chatter) unarchiveActivity(ctx context.Context, schema *util.ExpandingMap, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %sunarchive [activity]", commandPrefix)
+	}
+
+	activity := ""
+	if len(args) == 1 {
+		activity = args[0]
+	} else {
+		archived := schema.ArchivedPaths()
+		if len(archived) == 0 {
+			return fmt.Errorf("nothing is archived")
+		}
+
+		query := ""
+		for idx, path := range archived {
+			query += fmt.Sprintf("%d .) %s\n", idx, strings.Join(path, "."))
+		}
+		userInput, err := ctr.ask(ctx, query+"\nWhich activity would you like back in the menu?", func(ui *constructs.UserInput) error {
+			digit, err := strconv.Atoi(ui.Text)
+			if err != nil || digit < 0 || digit >= len(archived) {
+				return fmt.Errorf("input not in range [%d, %d]", 0, len(archived)-1)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		digit, _ := strconv.Atoi(userInput.Text)
+		activity = strings.Join(archived[digit], ".")
+	}
+
+	edit, err := schemaedit.Unarchive(activity)
+	if err != nil {
+		return err
+	}
+	return ctr.editSchema(ctx, schema, edit)
+}
+
+// editSchema shows what edit would change and makes it once confirmed, to
+// the stored schema and records as well as to schema, the menu's copy.
+func (ctr *Chatter) editSchema(ctx context.Context, schema *util.ExpandingMap, edit *schemaedit.Edit) error {
+	// The edit starts from the stored schema, which needs the options added this round.
+	if err := ctr.dumpSchema(ctx, &constructs.UserSchema{Schema: schema}); err != nil {
+		return fmt.Errorf("dumpSchema() returns err: %w", err)
+	}
+
+	preview, err := schemaedit.Apply(ctx, ctr.userSchemaDAO, ctr.userDataDAO, ctr.timerDAO, edit, true)
+	if err != nil {
+		return fmt.Errorf("schemaedit.Apply() returns err: %w", err)
+	}
+	confirmed, err := ctr.confirm(ctx, preview.Summary()+"\nGo ahead?")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		return nil
+	}
+
+	result, err := schemaedit.Apply(ctx, ctr.userSchemaDAO, ctr.userDataDAO, ctr.timerDAO, edit, false)
+	if err != nil {
+		return fmt.Errorf("schemaedit.Apply() returns err: %w", err)
+	}
+	if err := edit.ApplyTo(schema); err != nil {
+		return fmt.Errorf("ApplyTo() returns err: %w", err)
+	}
+	// The edit is saved already, it isn't one of this round's additions.
+	ctr.schemaBase = schema.Copy()
+
+	return ctr.userMessenger.Send(result.Summary())
+}
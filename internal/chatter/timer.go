@@ -0,0 +1,168 @@
+package chatter
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// startTimer times an activity from now on, picked from the menu unless
+// args name it, e.g. :start working.coding.
+func (ctr *Chatter) startTimer(ctx context.Context, schema *util.ExpandingMap, args []string) error {
+	timer, err := ctr.runningTimer(ctx)
+	if err != nil {
+		return fmt.Errorf("runningTimer() returns err: %w", err)
+	}
+	if timer != nil {
+		return fmt.Errorf("already timing %s, %sstop or %sswitch first", timer.Activity, commandPrefix, commandPrefix)
+	}
+
+	return ctr.pickActivity(ctx, schema, args, func(ctx context.Context, path []string, _ *util.ExpandingMap) error {
+		return ctr.beginTimer(ctx, path, time.Now())
+	})
+}
+
+// stopTimer records the running timer up to now.
+func (ctr *Chatter) stopTimer(ctx context.Context, _ *util.ExpandingMap, _ []string) error {
+	timer, err := ctr.runningTimer(ctx)
+	if err != nil {
+		return fmt.Errorf("runningTimer() returns err: %w", err)
+	}
+	if timer == nil {
+		return fmt.Errorf("no timer is running, %sstart starts one", commandPrefix)
+	}
+
+	recorded, err := ctr.endTimer(ctx, timer, time.Now())
+	if err != nil {
+		return err
+	}
+	if !recorded {
+		return ctr.userMessenger.Send(fmt.Sprintf("Not recorded, still timing %s.", timer.Activity))
+	}
+
+	return nil
+}
+
+// switchTimer stops the running timer and starts the next one at the same
+// moment, so no time falls between them.
+func (ctr *Chatter) switchTimer(ctx context.Context, schema *util.ExpandingMap, args []string) error {
+	timer, err := ctr.runningTimer(ctx)
+	if err != nil {
+		return fmt.Errorf("runningTimer() returns err: %w", err)
+	}
+	if timer == nil {
+		return ctr.startTimer(ctx, schema, args)
+	}
+
+	return ctr.pickActivity(ctx, schema, args, func(ctx context.Context, path []string, _ *util.ExpandingMap) error {
+		now := time.Now()
+
+		recorded, err := ctr.endTimer(ctx, timer, now)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			return ctr.userMessenger.Send(fmt.Sprintf("Not recorded, still timing %s.", timer.Activity))
+		}
+
+		return ctr.beginTimer(ctx, path, now)
+	})
+}
+
+// pickActivity hands onLeaf the activity args name, or else the one the user picks from the menu.
+func (ctr *Chatter) pickActivity(ctx context.Context, schema *util.ExpandingMap, args []string, onLeaf leafHandler) error {
+	if len(args) == 0 {
+		return ctr.writeRound(ctx, []string{}, schema, onLeaf)
+	}
+
+	path := strings.Split(args[0], ".")
+	subMap, err := schema.GetSubMap(path)
+	if err != nil {
+		return fmt.Errorf("%q is not in your schema", args[0])
+	}
+	if err := archivedOption(schema, path[:len(path)-1], path[len(path)-1]); err != nil {
+		return err
+	}
+	if len(subMap.VisibleKeys()) > 0 {
+		return ctr.writeRound(ctx, path, schema, onLeaf)
+	}
+
+	return onLeaf(ctx, path, schema)
+}
+
+func (ctr *Chatter) beginTimer(ctx context.Context, path []string, start time.Time) error {
+	timer := &constructs.Timer{
+		Activity: strings.Join(path, "."),
+		StartMS:  constructs.TimeToMS(start),
+	}
+
+	if err := ctr.timerDAO.SaveTimer(ctx, timer); err != nil {
+		return fmt.Errorf("timerDAO.SaveTimer() returns err: %w", err)
+	}
+
+	return ctr.userMessenger.Send(fmt.Sprintf("Timing %s since %s, %sstop records it.", timer.Activity, start.Format("15:04"), commandPrefix))
+}
+
+// endTimer records timer as done until end and clears it, once the user
+// agrees to anything unusual about it. It reports whether it did.
+func (ctr *Chatter) endTimer(ctx context.Context, timer *constructs.Timer, end time.Time) (bool, error) {
+	span := &util.TimeSpan{Start: timer.Start(), End: end}
+
+	if span.Duration() > util.MaxTimeSpan {
+		ok, err := ctr.confirm(ctx, fmt.Sprintf("%s has been timed for %s, longer than a day. Record it anyway?", timer.Activity, span.Duration().Round(time.Minute)))
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	ok, err := ctr.confirmOverlaps(ctx, span)
+	if err != nil {
+		return false, fmt.Errorf("confirmOverlaps() returns err: %w", err)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	path := strings.Split(timer.Activity, ".")
+	if err := ctr.appendRecord(ctx, path, span, nil); err != nil {
+		return false, fmt.Errorf("appendRecord() returns err: %w", err)
+	}
+
+	// Recorded first, so a crash in between can't lose the time.
+	if err := ctr.timerDAO.ClearTimer(ctx); err != nil {
+		return false, fmt.Errorf("timerDAO.ClearTimer() returns err: %w", err)
+	}
+
+	if err := ctr.userMessenger.Send(fmt.Sprintf("Recorded %s %dm.", timer.Activity, span.Minutes())); err != nil {
+		return false, fmt.Errorf("userMessenger.Send() returns err: %w", err)
+	}
+
+	return true, nil
+}
+
+// runningTimer returns nil if no timer is running.
+func (ctr *Chatter) runningTimer(ctx context.Context) (*constructs.Timer, error) {
+	timer, err := ctr.timerDAO.LoadTimer(ctx)
+	if err != nil {
+		if apperror.IsNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("timerDAO.LoadTimer() returns err: %w", err)
+	}
+	return timer, nil
+}
+
+// timerStatus describes the running timer for the top of the menu, empty if none is running.
+func (ctr *Chatter) timerStatus(ctx context.Context) (string, error) {
+	timer, err := ctr.runningTimer(ctx)
+	if err != nil || timer == nil {
+		return "", err
+	}
+
+	elapsed := int(time.Since(timer.Start()).Minutes())
+	return fmt.Sprintf("Timing %s since %s (%dm), %sstop records it, %sswitch moves on.", timer.Activity, timer.Start().Format("15:04"), elapsed, commandPrefix, commandPrefix), nil
+}
@@ -0,0 +1,209 @@
+// Package command runs activity_log one command at a time, for scripts,
+// hooks and editors that can't go through the interactive menu.
+package command
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/internal/config"
+	"activity_log/internal/dao"
+	"activity_log/internal/initializer"
+	"activity_log/internal/util"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDumpAttempts bounds how often a schema change retries after losing a race to another process.
+const maxDumpAttempts = 3
+
+// Env is what commands share with the interactive chatter.
+type Env struct {
+	SchemaDAO dao.UserSchemaDAO
+	DataDAO   dao.UserDataDAO
+	// TimerDAO may be nil, commands then leave the running timer alone.
+	TimerDAO dao.TimerDAO
+	Out      io.Writer
+	// Now is the current time, replaceable so tests can pin it.
+	Now func() time.Time
+	// Config is the effective configuration, for commands that report on it.
+	Config *config.Config
+	// Initializer runs the setup wizard.
+	Initializer *initializer.Initializer
+}
+
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, env *Env, args []string) error
+}
+
+func commands() map[string]*command {
+	return map[string]*command{
+		"log": {
+			usage: "log <activity> <time> [--note text] [--tag tag]... [#tag]...",
+			help:  "Record an activity, e.g. log working.coding 45m --note \"fixed the parser\" #ticket-123.",
+			run:   logActivity,
+		},
+		"schema": {
+			usage: "schema add <activity> | schema show | schema rename <activity> <new-name> | schema move <activity> <new-parent|.> | schema merge <activity> <into> | schema delete <activity> [--records-to activity] [--dry-run] | schema archive <activity> | schema unarchive <activity> | schema archived | schema set <activity> [--description text] [--color color] [--billable] [--rate n] [--daily-target 2h] [--weekly-target 10h] [--external-id id]",
+			help:  "Add an activity to your schema, creating its parents as needed, or print the schema. Renaming, moving, merging and deleting rewrite the records logged against the activity to match, --dry-run previews what would change. Archiving hides an activity from the menu and keeps its records, archived lists what is. Set describes an activity for the menu and gives it a color, a billing rate or a target.",
+			run:   schema,
+		},
+		"init": {
+			usage: "init",
+			help:  "Set activity_log up, or change or repair how it's set up.",
+			run:   initialize,
+		},
+		"list": {
+			usage: "list [--since when] [--until when] [--activity prefix] [--tag tag]... [--note text]",
+			help:  "Print the records matching the filters, oldest first.",
+			run:   list,
+		},
+		"config": {
+			usage: "config show",
+			help:  "Print every setting, its value and where the value came from.",
+			run:   showConfig,
+		},
+		"report": {
+			usage: "report [--since when] [--until when] [--depth levels] [--profiles name,... | --profiles all]",
+			help:  "Print the time spent on each activity, its sub-activities included, optionally across profiles.",
+			run:   report,
+		},
+		"profile": {
+			usage: "profile list | profile create <name> [--schema-from profile] | profile copy-schema <from> [to] | profile delete <name> --yes",
+			help:  "Manage profiles, each with its own schema and data. -profile picks the one to use.",
+			run:   profile,
+		},
+	}
+}
+
+// Run runs the command args name, e.g. []string{"list", "--since", "yesterday"}.
+func Run(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command")
+	}
+
+	if args[0] == "help" {
+		PrintUsage(env.Out)
+		return nil
+	}
+
+	cmd, ok := commands()[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, help lists commands", args[0])
+	}
+
+	return cmd.run(ctx, env, args[1:])
+}
+
+// PrintUsage lists the commands.
+func PrintUsage(out io.Writer) {
+	cmds := commands()
+
+	names := []string{}
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(out, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n    \t%s\n", cmds[name].usage, cmds[name].help)
+	}
+}
+
+func initialize(ctx context.Context, env *Env, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	return env.Initializer.Init(ctx)
+}
+
+func showConfig(_ context.Context, env *Env, args []string) error {
+	if len(args) != 1 || args[0] != "show" {
+		return fmt.Errorf("usage: %s", commands()["config"].usage)
+	}
+
+	return env.Config.Show(env.Out)
+}
+
+// parseArgs parses the flags of fs wherever they are among args, so they can
+// follow the positional arguments as in "log working.coding 45m --note ...".
+// It returns the positional arguments. Everything after "--" is positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		consumed := len(args) - fs.NArg()
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, fs.Args()...), nil
+		}
+
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func newFlagSet(env *Env, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.Out)
+	fs.Usage = func() {
+		fmt.Fprintf(env.Out, "Usage: %s\n", commands()[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
+// parseWhen reads a point in time for --since and --until: today,
+// yesterday or YYYY-MM-DD mean the start of that day, and a duration like
+// 2h or 7d means that long before now. Empty is the zero time.
+func parseWhen(text string, now time.Time) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+
+	if days, err := parseDays(text); err == nil {
+		return now.AddDate(0, 0, -days), nil
+	}
+	if d, err := time.ParseDuration(text); err == nil {
+		return now.Add(-d), nil
+	}
+
+	day, err := util.ParseDay(text, now)
+	if err != nil {
+		return time.Time{}, apperror.NewUserConfusedError(fmt.Errorf("%q isn't a day like yesterday or 2021-11-12, or a duration like 2h or 7d", text))
+	}
+	return util.StartOfDay(day), nil
+}
+
+// parseDays reads a number of days like "7d".
+func parseDays(text string) (int, error) {
+	if !strings.HasSuffix(text, "d") {
+		return 0, fmt.Errorf("%q doesn't end in d", text)
+	}
+	return strconv.Atoi(strings.TrimSuffix(text, "d"))
+}
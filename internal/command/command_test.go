@@ -0,0 +1,331 @@
+package command_test
+
+import (
+	"activity_log/internal/command"
+	"activity_log/internal/config"
+	"activity_log/internal/dao/backend"
+	datadao "activity_log/internal/dao/data_dao"
+	schemadao "activity_log/internal/dao/schema_dao"
+	"bytes"
+	"context"
+	"flag"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2021, 11, 12, 18, 0, 0, 0, time.Local)
+
+func newEnv(t *testing.T) (*command.Env, *bytes.Buffer) {
+	dir := t.TempDir()
+	schemaDAO := schemadao.NewLocalSchemaDAO(filepath.Join(dir, "schema.json"), 0)
+	if _, err := schemaDAO.Init(context.Background()); err != nil {
+		t.Fatalf("Init() returns err: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	return &command.Env{
+		SchemaDAO: schemaDAO,
+		DataDAO:   datadao.NewDataDAO(filepath.Join(dir, "data.csv")),
+		Out:       out,
+		Now:       func() time.Time { return now },
+	}, out
+}
+
+// run runs each command in turn and returns what the last one printed.
+func run(t *testing.T, env *command.Env, out *bytes.Buffer, cmds ...string) string {
+	for _, cmd := range cmds {
+		out.Reset()
+		if err := command.Run(context.Background(), env, strings.Fields(cmd)); err != nil {
+			t.Fatalf("Run(%q) returns err: %v", cmd, err)
+		}
+	}
+	return out.String()
+}
+
+func TestLogAndList(t *testing.T) {
+	env, out := newEnv(t)
+	run(t, env, out,
+		"schema add working.coding",
+		"schema add SideProject",
+		"log working.coding 45m --note parser #ticket-123 --tag pairing",
+		"log SideProject 16:00-16:30 --tag ticket-123",
+	)
+
+	testCases := []struct {
+		desc string
+		cmd  string
+		want []string
+	}{
+		{
+			desc: "everything",
+			cmd:  "list",
+			want: []string{
+				"2021-11-12 16:00-16:30 SideProject 30m #ticket-123",
+				"2021-11-12 17:15-18:00 working.coding 45m #pairing #ticket-123 parser",
+			},
+		},
+		{
+			desc: "every tag",
+			cmd:  "list --tag ticket-123 --tag #pairing",
+			want: []string{"2021-11-12 17:15-18:00 working.coding 45m #pairing #ticket-123 parser"},
+		},
+		{
+			desc: "activity and window",
+			cmd:  "list --activity working --since 1h",
+			want: []string{"2021-11-12 17:15-18:00 working.coding 45m #pairing #ticket-123 parser"},
+		},
+		{
+			desc: "nothing before today",
+			cmd:  "list --until today",
+			want: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := strings.Fields(run(t, env, out, tc.cmd))
+			want := strings.Fields(strings.Join(tc.want, " "))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Run(%q) prints %q, want %q", tc.cmd, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLogRejects(t *testing.T) {
+	env, out := newEnv(t)
+	run(t, env, out, "schema add working.coding")
+
+	for _, cmd := range []string{
+		"log working 45m",
+		"log nope 45m",
+		"log working.coding 19:00-19:30",
+		"log working.coding 45m stray",
+	} {
+		if err := command.Run(context.Background(), env, strings.Fields(cmd)); err == nil {
+			t.Errorf("Run(%q) returns no err, want one", cmd)
+		}
+	}
+}
+
+func TestSchemaAddKeepsParent(t *testing.T) {
+	env, out := newEnv(t)
+
+	got := run(t, env, out,
+		"schema add working",
+		"schema add working.coding.debugging",
+		"schema show",
+	)
+
+	want := "default\nworking\n  coding\n    debugging\n  working\n"
+	if got != want {
+		t.Errorf("schema show prints %q, want %q", got, want)
+	}
+}
+
+func TestSchemaSet(t *testing.T) {
+	env, out := newEnv(t)
+
+	got := run(t, env, out,
+		"schema add working.coding",
+		"schema add working.meeting",
+		"schema set working --description dayjob --color blue --billable --rate 120 --daily-target 6h --external-id ACME-1",
+		"schema set working --daily-target 0 --weekly-target 30h",
+		"schema archive working.meeting",
+		"schema show",
+	)
+
+	want := "default\n" +
+		"working -- dayjob [blue, billable at 120/h, 30h a week, id ACME-1]\n" +
+		"  coding\n" +
+		"  meeting (archived)\n"
+	if got != want {
+		t.Errorf("schema show prints %q, want %q", got, want)
+	}
+
+	for _, cmd := range []string{
+		"schema set working",
+		"schema set working --color mauve",
+		"schema set working.coding --rate 10",
+		"schema set nope --color red",
+		"log working.meeting 15m",
+	} {
+		if err := command.Run(context.Background(), env, strings.Fields(cmd)); err == nil {
+			t.Errorf("Run(%q) returns no err, want one", cmd)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	env, out := newEnv(t)
+
+	got := run(t, env, out,
+		"schema add working.coding",
+		"schema add working.meeting",
+		"log working.coding 14:00-15:30",
+		"log working.meeting 15:30-15:45",
+		"log working.coding 16:00-16:30",
+		"report",
+	)
+
+	want := "working    2h15m\n" +
+		"  coding   2h\n" +
+		"  meeting  15m\n" +
+		"total      2h15m\n"
+	if got != want {
+		t.Errorf("report prints %q, want %q", got, want)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := config.NewLoader(fs)
+	cfg, err := loader.LoadWithoutFile(func(key string) string {
+		if key == "XDG_DATA_HOME" {
+			return dir
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatalf("LoadWithoutFile() returns err: %v", err)
+	}
+	if err := cfg.MakeDirs(); err != nil {
+		t.Fatalf("MakeDirs() returns err: %v", err)
+	}
+	daos, err := backend.Open(cfg)
+	if err != nil {
+		t.Fatalf("backend.Open() returns err: %v", err)
+	}
+	if _, err := daos.Schema.Init(context.Background()); err != nil {
+		t.Fatalf("Init() returns err: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	env := &command.Env{
+		SchemaDAO: daos.Schema,
+		DataDAO:   daos.Data,
+		Out:       out,
+		Now:       func() time.Time { return now },
+		Config:    cfg,
+	}
+
+	run(t, env, out,
+		"schema add working.coding",
+		"log working.coding 14:00-15:30",
+		"profile create home --schema-from default",
+	)
+
+	homeCfg, err := cfg.ForProfile("home")
+	if err != nil {
+		t.Fatalf("ForProfile() returns err: %v", err)
+	}
+	homeDAOs, err := backend.Open(homeCfg)
+	if err != nil {
+		t.Fatalf("backend.Open() returns err: %v", err)
+	}
+	homeEnv := &command.Env{
+		SchemaDAO: homeDAOs.Schema,
+		DataDAO:   homeDAOs.Data,
+		Out:       out,
+		Now:       env.Now,
+		Config:    homeCfg,
+	}
+	run(t, homeEnv, out, "log working.coding 16:00-16:30")
+
+	testCases := []struct {
+		desc string
+		cmd  string
+		want string
+	}{
+		{
+			desc: "list",
+			cmd:  "profile list",
+			want: "* default\n  home\n",
+		},
+		{
+			desc: "report in one",
+			cmd:  "report",
+			want: "working   1h30m\n  coding  1h30m\ntotal     1h30m\n",
+		},
+		{
+			desc: "report across",
+			cmd:  "report --profiles all --depth 1",
+			want: "default    1h30m\n  working  1h30m\nhome       30m\n  working  30m\ntotal      2h\n",
+		},
+		{
+			desc: "report naming a profile twice",
+			cmd:  "report --profiles home,default,home --depth 1",
+			want: "default    1h30m\n  working  1h30m\nhome       30m\n  working  30m\ntotal      2h\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := run(t, env, out, tc.cmd); got != tc.want {
+				t.Errorf("%s prints %q, want %q", tc.cmd, got, tc.want)
+			}
+		})
+	}
+
+	for _, cmd := range []string{"profile delete home", "profile delete default --yes", "profile create home", "profile copy-schema nowhere"} {
+		if err := command.Run(context.Background(), env, strings.Fields(cmd)); err == nil {
+			t.Errorf("Run(%q) returns no err, want one", cmd)
+		}
+	}
+
+	got := run(t, env, out, "profile delete home --yes", "profile list")
+	if want := "* default\n"; got != want {
+		t.Errorf("profile list after delete prints %q, want %q", got, want)
+	}
+}
+
+func TestReportProfilesSharingData(t *testing.T) {
+	dir := t.TempDir()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := config.NewLoader(fs).LoadWithoutFile(func(key string) string {
+		switch key {
+		case "XDG_DATA_HOME":
+			return dir
+		case "ACTIVITY_LOG_DATA":
+			// Set explicitly, every profile keeps its records here.
+			return filepath.Join(dir, "shared.csv")
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatalf("LoadWithoutFile() returns err: %v", err)
+	}
+	if err := cfg.MakeDirs(); err != nil {
+		t.Fatalf("MakeDirs() returns err: %v", err)
+	}
+	daos, err := backend.Open(cfg)
+	if err != nil {
+		t.Fatalf("backend.Open() returns err: %v", err)
+	}
+	if _, err := daos.Schema.Init(context.Background()); err != nil {
+		t.Fatalf("Init() returns err: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	env := &command.Env{
+		SchemaDAO: daos.Schema,
+		DataDAO:   daos.Data,
+		Out:       out,
+		Now:       func() time.Time { return now },
+		Config:    cfg,
+	}
+	run(t, env, out,
+		"schema add working.coding",
+		"log working.coding 14:00-15:30",
+		"profile create home --schema-from default",
+	)
+
+	got := run(t, env, out, "report --profiles all --depth 1")
+	if want := "default    1h30m\n  working  1h30m\ntotal      1h30m\n"; got != want {
+		t.Errorf("report across profiles sharing data prints %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"activity_log/api/constructs"
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func list(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "list")
+	window := addWindowFlags(fs)
+	activity := fs.String("activity", "", "only this activity and its sub-activities")
+	note := fs.String("note", "", "only records whose note contains this, ignoring case")
+	tags := stringList{}
+	fs.Var(&tags, "tag", "only records with this tag, may be given more than once")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return fmt.Errorf("unexpected arguments %v", positional)
+	}
+
+	filter, err := window.filter(env.Now())
+	if err != nil {
+		return err
+	}
+	filter.ActivityPrefix = *activity
+	filter.NoteContains = *note
+	filter.Tags = tags
+
+	records, err := env.DataDAO.List(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("DataDAO.List() returns err: %w", err)
+	}
+
+	for _, record := range records {
+		fmt.Fprintln(env.Out, record)
+	}
+	return nil
+}
+
+// windowFlags are the --since and --until flags of commands that read records.
+type windowFlags struct {
+	since *string
+	until *string
+}
+
+func addWindowFlags(fs *flag.FlagSet) *windowFlags {
+	return &windowFlags{
+		since: fs.String("since", "", "only records ending from then on: today, yesterday, YYYY-MM-DD, or a duration back from now like 2h or 7d"),
+		until: fs.String("until", "", "only records ending before then, in the same forms as --since"),
+	}
+}
+
+func (wf *windowFlags) filter(now time.Time) (*constructs.UserDataFilter, error) {
+	since, err := parseWhen(*wf.since, now)
+	if err != nil {
+		return nil, fmt.Errorf("--since: %w", err)
+	}
+	until, err := parseWhen(*wf.until, now)
+	if err != nil {
+		return nil, fmt.Errorf("--until: %w", err)
+	}
+
+	filter := &constructs.UserDataFilter{}
+	if !since.IsZero() {
+		filter.SinceMS = constructs.TimeToMS(since)
+	}
+	if !until.IsZero() {
+		filter.UntilMS = constructs.TimeToMS(until)
+	}
+	return filter, nil
+}
@@ -0,0 +1,120 @@
+package command
+
+import (
+	"activity_log/api/constructs"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// logActivity records an activity the way the chatter does, from arguments
+// rather than answers.
+func logActivity(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "log")
+	note := fs.String("note", "", "free text about the activity")
+	tags := stringList{}
+	fs.Var(&tags, "tag", "tag the record, may be given more than once")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// #words after the time are tags too, as they are in the chatter.
+	if len(positional) < 2 {
+		fs.Usage()
+		return fmt.Errorf("log needs an activity and a time")
+	}
+	for _, word := range positional[2:] {
+		if !strings.HasPrefix(word, "#") {
+			return fmt.Errorf("unexpected argument %q, quote the time or pass a note with --note", word)
+		}
+		tags = append(tags, word)
+	}
+
+	activity := positional[0]
+	if err := checkLoggable(ctx, env, activity); err != nil {
+		return err
+	}
+
+	now := env.Now()
+	lastRecord, err := lastRecordEnd(ctx, env)
+	if err != nil {
+		return fmt.Errorf("lastRecordEnd() returns err: %w", err)
+	}
+	span, err := util.ParseTimeSpan(positional[1], now, lastRecord)
+	if err != nil {
+		return fmt.Errorf("ParseTimeSpan(%s) returns err: %w", positional[1], err)
+	}
+
+	userData := &constructs.UserData{
+		Data: map[string]interface{}{
+			string(constructs.Activity):     activity,
+			string(constructs.MinutesSpent): span.Minutes(),
+		},
+	}
+	userData.SetSpan(span.Start, span.End)
+	userData.SetNote(*note)
+	userData.SetTags(tags)
+
+	overlapping, err := env.DataDAO.List(ctx, &constructs.UserDataFilter{SinceMS: constructs.TimeToMS(span.Start) + 1})
+	if err != nil {
+		return fmt.Errorf("DataDAO.List() returns err: %w", err)
+	}
+	for _, record := range overlapping {
+		if record.Overlaps(span.Start, span.End) {
+			fmt.Fprintf(env.Out, "Warning: overlaps with %s\n", record)
+		}
+	}
+
+	if err := env.DataDAO.Append(ctx, userData); err != nil {
+		return fmt.Errorf("DataDAO.Append() returns err: %w", err)
+	}
+
+	fmt.Fprintf(env.Out, "Recorded %s\n", userData)
+	return nil
+}
+
+// checkLoggable returns an error unless activity is in the schema, not
+// archived and without sub-activities, like the activities the menu lets you
+// pick.
+func checkLoggable(ctx context.Context, env *Env, activity string) error {
+	us, err := env.SchemaDAO.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("SchemaDAO.Load() returns err: %w", err)
+	}
+
+	path := strings.Split(activity, ".")
+	subMap, err := us.Schema.GetSubMap(path)
+	if err != nil {
+		return fmt.Errorf("%q is not in your schema, schema add creates it", activity)
+	}
+	if us.Schema.IsArchived(path) {
+		return fmt.Errorf("%q is archived, schema unarchive puts it back", activity)
+	}
+	// Sub-activities that are all archived leave nothing else to log.
+	if visible := subMap.VisibleKeys(); len(visible) > 0 {
+		return fmt.Errorf("%q has sub-activities, log one of them: %s", activity, strings.Join(visible, ", "))
+	}
+
+	return nil
+}
+
+// lastRecordEnd is when the latest record of the last day ended, which
+// "until now" starts from. It's the zero time if there is none.
+func lastRecordEnd(ctx context.Context, env *Env) (time.Time, error) {
+	records, err := env.DataDAO.List(ctx, &constructs.UserDataFilter{SinceMS: constructs.TimeToMS(env.Now().Add(-util.MaxTimeSpan))})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("DataDAO.List() returns err: %w", err)
+	}
+
+	last := time.Time{}
+	for _, record := range records {
+		if record.End().After(last) {
+			last = record.End()
+		}
+	}
+	return last, nil
+}
@@ -0,0 +1,253 @@
+package command
+
+import (
+	"activity_log/api/constants"
+	"activity_log/api/constructs"
+	"activity_log/internal/dao/backend"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func profile(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", commands()["profile"].usage)
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s", commands()["profile"].usage)
+		}
+		return listProfiles(env)
+	case "create":
+		return createProfile(ctx, env, args[1:])
+	case "copy-schema":
+		if len(args) != 2 && len(args) != 3 {
+			return fmt.Errorf("usage: %s", commands()["profile"].usage)
+		}
+		to := env.Config.Profile
+		if len(args) == 3 {
+			to = args[2]
+		}
+		return copySchema(ctx, env, args[1], to)
+	case "delete":
+		return deleteProfile(env, args[1:])
+	default:
+		return fmt.Errorf("unknown profile command %q, usage: %s", args[0], commands()["profile"].usage)
+	}
+}
+
+// listProfiles prints every profile, marking the one in use.
+func listProfiles(env *Env) error {
+	profiles, err := env.Config.Profiles()
+	if err != nil {
+		return fmt.Errorf("Config.Profiles() returns err: %w", err)
+	}
+
+	for _, name := range profiles {
+		marker := " "
+		if name == env.Config.Profile {
+			marker = "*"
+		}
+		fmt.Fprintf(env.Out, "%s %s\n", marker, name)
+	}
+	return nil
+}
+
+func createProfile(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "profile")
+	schemaFrom := fs.String("schema-from", "", "profile to copy the schema of, instead of starting empty")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: %s", commands()["profile"].usage)
+	}
+	name := positional[0]
+
+	cfg, err := env.Config.ForProfile(name)
+	if err != nil {
+		return err
+	}
+	if cfg.HasProfile(name) {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+	// Load the schema to copy first, so failing to leaves nothing behind.
+	var us *constructs.UserSchema
+	if *schemaFrom != "" {
+		if err := validateExistingProfile(env, *schemaFrom); err != nil {
+			return err
+		}
+		fromDAOs, err := openProfile(env, *schemaFrom)
+		if err != nil {
+			return fmt.Errorf("openProfile(%s) returns err: %w", *schemaFrom, err)
+		}
+		if us, err = fromDAOs.Schema.Load(ctx); err != nil {
+			return fmt.Errorf("Schema.Load() of %s returns err: %w", *schemaFrom, err)
+		}
+	}
+
+	if err := os.MkdirAll(cfg.ProfileDir(name), 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll(%s) returns err: %w", cfg.ProfileDir(name), err)
+	}
+	if err := cfg.MakeDirs(); err != nil {
+		return fmt.Errorf("MakeDirs() returns err: %w", err)
+	}
+
+	daos, err := backend.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("backend.Open() returns err: %w", err)
+	}
+	if us != nil {
+		err = daos.Schema.Dump(ctx, us, true)
+	} else {
+		_, err = daos.Schema.Init(ctx)
+	}
+	if err != nil {
+		os.RemoveAll(cfg.ProfileDir(name))
+		return fmt.Errorf("saving the schema of %s returns err: %w", name, err)
+	}
+
+	fmt.Fprintf(env.Out, "Created profile %s, use it with -profile %s\n", name, name)
+	return nil
+}
+
+// copySchema replaces the schema of profile to with the one of profile
+// from. Records in to are kept, whatever activities they were logged against.
+func copySchema(ctx context.Context, env *Env, from string, to string) error {
+	if from == to {
+		return fmt.Errorf("can't copy the schema of %q onto itself", from)
+	}
+	for _, name := range []string{from, to} {
+		if err := validateExistingProfile(env, name); err != nil {
+			return err
+		}
+	}
+
+	fromDAOs, err := openProfile(env, from)
+	if err != nil {
+		return fmt.Errorf("openProfile(%s) returns err: %w", from, err)
+	}
+	toDAOs, err := openProfile(env, to)
+	if err != nil {
+		return fmt.Errorf("openProfile(%s) returns err: %w", to, err)
+	}
+
+	us, err := fromDAOs.Schema.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("Schema.Load() of %s returns err: %w", from, err)
+	}
+	if err := toDAOs.Schema.Dump(ctx, us, true); err != nil {
+		return fmt.Errorf("Schema.Dump() of %s returns err: %w", to, err)
+	}
+
+	fmt.Fprintf(env.Out, "Copied the schema of %s to %s\n", from, to)
+	return nil
+}
+
+// deleteProfile removes a profile's directory, and with it its schema and
+// data, so it must be confirmed with --yes.
+func deleteProfile(env *Env, args []string) error {
+	fs := newFlagSet(env, "profile")
+	yes := fs.Bool("yes", false, "confirm deleting the profile's schema and data for good")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: %s", commands()["profile"].usage)
+	}
+	name := positional[0]
+
+	if err := validateExistingProfile(env, name); err != nil {
+		return err
+	}
+	if name == constants.DEFAULT_PROFILE {
+		return fmt.Errorf("can't delete the default profile")
+	}
+	if name == env.Config.Profile {
+		return fmt.Errorf("can't delete %q while using it", name)
+	}
+	if !*yes {
+		return fmt.Errorf("deleting %s removes its schema and data for good, add --yes to go ahead", name)
+	}
+
+	if err := os.RemoveAll(env.Config.ProfileDir(name)); err != nil {
+		return fmt.Errorf("os.RemoveAll(%s) returns err: %w", env.Config.ProfileDir(name), err)
+	}
+
+	fmt.Fprintf(env.Out, "Deleted profile %s\n", name)
+	return nil
+}
+
+func validateExistingProfile(env *Env, name string) error {
+	if !env.Config.HasProfile(name) {
+		return fmt.Errorf("no profile %q, profile list shows them", name)
+	}
+	return nil
+}
+
+// openProfile returns the DAOs of the profile name, the ones in env for the
+// profile in use.
+func openProfile(env *Env, name string) (*backend.DAOs, error) {
+	if name == env.Config.Profile {
+		return &backend.DAOs{Schema: env.SchemaDAO, Data: env.DataDAO}, nil
+	}
+
+	cfg, err := env.Config.ForProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Open(cfg)
+}
+
+// parseProfiles reads the profiles --profiles names, a comma separated list
+// or all of them. Each profile is in it once, and so is each data store: of
+// profiles that keep their records in the same place, only the first is.
+func parseProfiles(env *Env, text string) ([]string, error) {
+	names := []string{}
+	if text == "all" {
+		var err error
+		if names, err = env.Config.Profiles(); err != nil {
+			return nil, fmt.Errorf("Profiles() returns err: %w", err)
+		}
+	} else {
+		names = strings.Split(text, ",")
+	}
+
+	profiles := []string{}
+	seenNames, seenStores := map[string]bool{}, map[string]bool{}
+	for _, name := range names {
+		if err := validateExistingProfile(env, name); err != nil {
+			return nil, err
+		}
+		store, err := profileStore(env, name)
+		if err != nil {
+			return nil, fmt.Errorf("profileStore(%s) returns err: %w", name, err)
+		}
+		if seenNames[name] || seenStores[store] {
+			continue
+		}
+		seenNames[name], seenStores[store] = true, true
+		profiles = append(profiles, name)
+	}
+	return profiles, nil
+}
+
+// profileStore is the file the profile name keeps its records in.
+func profileStore(env *Env, name string) (string, error) {
+	cfg, err := env.Config.ForProfile(name)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Backend == "bolt" {
+		return filepath.Clean(cfg.DBPath), nil
+	}
+	return filepath.Clean(cfg.DataPath), nil
+}
@@ -0,0 +1,107 @@
+package command
+
+import (
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// report totals the minutes of every activity, counting each record
+// towards the activity it was logged against and all of that one's parents.
+// Across profiles, each profile heads the activities logged in it.
+func report(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "report")
+	window := addWindowFlags(fs)
+	depth := fs.Int("depth", 0, "how many levels of activities to show, 0 shows them all")
+	profilesFlag := fs.String("profiles", "", "comma separated profiles to report across, or all of them")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return fmt.Errorf("unexpected arguments %v", positional)
+	}
+
+	filter, err := window.filter(env.Now())
+	if err != nil {
+		return err
+	}
+
+	// Without --profiles, records are reported as they are, in the profile in use.
+	profiles := []string{""}
+	if *profilesFlag != "" {
+		if profiles, err = parseProfiles(env, *profilesFlag); err != nil {
+			return err
+		}
+	}
+
+	totals := map[string]int{}
+	total := 0
+	for _, name := range profiles {
+		dataDAO := env.DataDAO
+		prefix := []string{}
+		if name != "" {
+			daos, err := openProfile(env, name)
+			if err != nil {
+				return fmt.Errorf("openProfile(%s) returns err: %w", name, err)
+			}
+			dataDAO = daos.Data
+			prefix = []string{name}
+		}
+
+		records, err := dataDAO.List(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("DataDAO.List() returns err: %w", err)
+		}
+
+		for _, record := range records {
+			minutes, err := record.Minutes()
+			if err != nil {
+				return fmt.Errorf("Minutes() of %s returns err: %w", record.ID, err)
+			}
+			total += minutes
+
+			path := strings.Split(record.ActivityPath(), ".")
+			for idx := range path {
+				if *depth > 0 && idx >= *depth {
+					break
+				}
+				totals[strings.Join(append(prefix, path[:idx+1]...), ".")] += minutes
+			}
+			if len(prefix) > 0 {
+				totals[name] += minutes
+			}
+		}
+	}
+
+	// Sorting the paths puts every activity right above its sub-activities.
+	activities := []string{}
+	for activity := range totals {
+		activities = append(activities, activity)
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		return lessPath(strings.Split(activities[i], "."), strings.Split(activities[j], "."))
+	})
+
+	writer := tabwriter.NewWriter(env.Out, 0, 0, 2, ' ', 0)
+	for _, activity := range activities {
+		path := strings.Split(activity, ".")
+		fmt.Fprintf(writer, "%s%s\t%s\n", strings.Repeat("  ", len(path)-1), path[len(path)-1], util.FormatMinutes(totals[activity]))
+	}
+	fmt.Fprintf(writer, "total\t%s\n", util.FormatMinutes(total))
+
+	return writer.Flush()
+}
+
+func lessPath(lhs []string, rhs []string) bool {
+	for idx := 0; idx < len(lhs) && idx < len(rhs); idx++ {
+		if lhs[idx] != rhs[idx] {
+			return lhs[idx] < rhs[idx]
+		}
+	}
+	return len(lhs) < len(rhs)
+}
@@ -0,0 +1,332 @@
+package command
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/internal/schemaedit"
+	"activity_log/internal/util"
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func schema(ctx context.Context, env *Env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", commands()["schema"].usage)
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s", commands()["schema"].usage)
+		}
+		return addActivity(ctx, env, args[1])
+	case "show":
+		return showSchema(ctx, env)
+	case "archived":
+		return listArchived(ctx, env)
+	case "set":
+		return setMeta(ctx, env, args[1:])
+	case "rename", "move", "merge", "delete", "archive", "unarchive":
+		return editSchema(ctx, env, args[0], args[1:])
+	default:
+		return fmt.Errorf("unknown schema command %q, usage: %s", args[0], commands()["schema"].usage)
+	}
+}
+
+// addActivity adds the dot separated activity to the schema. An activity
+// that gains its first sub-activity keeps itself as an option, like it does
+// when expanded from the menu, so it can still be logged.
+func addActivity(ctx context.Context, env *Env, activity string) error {
+	path := strings.Split(activity, ".")
+	for _, name := range path {
+		if name == "" {
+			return fmt.Errorf("%q has an empty part", activity)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		us, err := env.SchemaDAO.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("SchemaDAO.Load() returns err: %w", err)
+		}
+
+		added, err := addPath(us.Schema, path)
+		if err != nil {
+			return fmt.Errorf("addPath(%v) returns err: %w", path, err)
+		}
+		if !added {
+			if us.Schema.IsArchived(path) {
+				fmt.Fprintf(env.Out, "%s is in your schema but archived, schema unarchive puts it back\n", activity)
+				return nil
+			}
+			fmt.Fprintf(env.Out, "%s is already in your schema\n", activity)
+			return nil
+		}
+
+		// Another process saved the schema since it was loaded, start over from theirs.
+		err = env.SchemaDAO.Dump(ctx, us, false)
+		if apperror.IsConflictError(err) && attempt < maxDumpAttempts {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("SchemaDAO.Dump() returns err: %w", err)
+		}
+
+		fmt.Fprintf(env.Out, "Added %s\n", activity)
+		return nil
+	}
+}
+
+// addPath adds whatever part of path schema is missing, and reports whether anything was.
+func addPath(schema *util.ExpandingMap, path []string) (bool, error) {
+	added := false
+	for idx := range path {
+		if _, err := schema.GetSubMap(path[:idx+1]); err == nil {
+			continue
+		}
+
+		parent := path[:idx]
+		parentMap, err := schema.GetSubMap(parent)
+		if err != nil {
+			return false, fmt.Errorf("GetSubMap(%v) returns err: %w", parent, err)
+		}
+
+		if len(parent) > 0 && parentMap.IsEmpty() && !added {
+			err = schema.AddSubMapIncludingParent(parent, path[idx])
+		} else {
+			err = schema.AddSubMap(parent, path[idx])
+		}
+		if err != nil {
+			return false, err
+		}
+		added = true
+	}
+
+	return added, nil
+}
+
+func showSchema(ctx context.Context, env *Env) error {
+	us, err := env.SchemaDAO.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("SchemaDAO.Load() returns err: %w", err)
+	}
+
+	printTree(env, us.Schema, 0)
+	return nil
+}
+
+func printTree(env *Env, tree *util.ExpandingMap, depth int) {
+	for _, key := range tree.Keys() {
+		subTree, _ := tree.GetSubMap([]string{key})
+		fmt.Fprintf(env.Out, "%s%s%s\n", strings.Repeat("  ", depth), key, describeMeta(subTree.Meta()))
+		printTree(env, subTree, depth+1)
+	}
+}
+
+// describeMeta is meta as it's printed after an activity, empty if there's nothing to say.
+func describeMeta(meta util.NodeMeta) string {
+	text := ""
+	if meta.Archived {
+		text += " (archived)"
+	}
+	if meta.Description != "" {
+		text += " -- " + meta.Description
+	}
+
+	details := []string{}
+	if meta.Color != "" {
+		details = append(details, meta.Color)
+	}
+	if meta.Billable {
+		billable := "billable"
+		if meta.Rate != 0 {
+			billable += fmt.Sprintf(" at %s/h", strconv.FormatFloat(meta.Rate, 'f', -1, 64))
+		}
+		details = append(details, billable)
+	}
+	if meta.DailyTargetMinutes != 0 {
+		details = append(details, fmt.Sprintf("%s a day", util.FormatMinutes(meta.DailyTargetMinutes)))
+	}
+	if meta.WeeklyTargetMinutes != 0 {
+		details = append(details, fmt.Sprintf("%s a week", util.FormatMinutes(meta.WeeklyTargetMinutes)))
+	}
+	if meta.ExternalID != "" {
+		details = append(details, "id "+meta.ExternalID)
+	}
+	if len(details) > 0 {
+		text += fmt.Sprintf(" [%s]", strings.Join(details, ", "))
+	}
+
+	return text
+}
+
+// setMeta changes what's kept about an activity, e.g. its description or
+// daily target, leaving what no flag names as it was.
+func setMeta(ctx context.Context, env *Env, args []string) error {
+	fs := newFlagSet(env, "schema")
+	description := fs.String("description", "", "what the activity is for, shown next to it in the menu")
+	color := fs.String("color", "", fmt.Sprintf("color to show the activity in the menu in: %s, empty for none", strings.Join(util.NodeColors, ", ")))
+	billable := fs.Bool("billable", false, "whether time spent on the activity is billed")
+	rate := fs.Float64("rate", 0, "what an hour of a billable activity is billed at")
+	dailyTarget := fs.String("daily-target", "", "how long to aim to spend on the activity a day, e.g. 2h or 90, 0 for none")
+	weeklyTarget := fs.String("weekly-target", "", "how long to aim to spend on the activity a week, e.g. 10h, 0 for none")
+	externalID := fs.String("external-id", "", "what the activity is called elsewhere, e.g. a project code")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: %s", commands()["schema"].usage)
+	}
+	activity := positional[0]
+	path := strings.Split(activity, ".")
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if len(set) == 0 {
+		return fmt.Errorf("nothing to set, see schema -h for what can be")
+	}
+
+	dailyMinutes, err := parseTarget(*dailyTarget)
+	if err != nil {
+		return err
+	}
+	weeklyMinutes, err := parseTarget(*weeklyTarget)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		us, err := env.SchemaDAO.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("SchemaDAO.Load() returns err: %w", err)
+		}
+
+		subMap, err := us.Schema.GetSubMap(path)
+		if err != nil {
+			return fmt.Errorf("%q is not in your schema, schema add creates it", activity)
+		}
+		meta := subMap.Meta()
+		if set["description"] {
+			meta.Description = *description
+		}
+		if set["color"] {
+			meta.Color = *color
+		}
+		if set["billable"] {
+			meta.Billable = *billable
+			if !meta.Billable {
+				meta.Rate = 0
+			}
+		}
+		if set["rate"] {
+			meta.Rate = *rate
+		}
+		if set["daily-target"] {
+			meta.DailyTargetMinutes = dailyMinutes
+		}
+		if set["weekly-target"] {
+			meta.WeeklyTargetMinutes = weeklyMinutes
+		}
+		if set["external-id"] {
+			meta.ExternalID = *externalID
+		}
+		if err := us.Schema.SetMeta(path, meta); err != nil {
+			return err
+		}
+
+		// Another process saved the schema since it was loaded, start over from theirs.
+		err = env.SchemaDAO.Dump(ctx, us, false)
+		if apperror.IsConflictError(err) && attempt < maxDumpAttempts {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("SchemaDAO.Dump() returns err: %w", err)
+		}
+
+		fmt.Fprintf(env.Out, "%s%s\n", activity, describeMeta(meta))
+		return nil
+	}
+}
+
+// parseTarget reads a target like 2h or 90, in minutes. Empty is none.
+func parseTarget(text string) (int, error) {
+	if text == "" {
+		return 0, nil
+	}
+	if minutes, err := strconv.Atoi(text); err == nil && minutes >= 0 {
+		return minutes, nil
+	}
+	if d, err := time.ParseDuration(text); err == nil && d >= 0 {
+		return int(d.Minutes()), nil
+	}
+	return 0, apperror.NewUserConfusedError(fmt.Errorf("%q isn't a target like 2h or 90", text))
+}
+
+// listArchived prints the archived activities, leaving out those archived
+// along with one above them.
+func listArchived(ctx context.Context, env *Env) error {
+	us, err := env.SchemaDAO.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("SchemaDAO.Load() returns err: %w", err)
+	}
+
+	archived := us.Schema.ArchivedPaths()
+	if len(archived) == 0 {
+		fmt.Fprintln(env.Out, "Nothing is archived.")
+		return nil
+	}
+	for _, path := range archived {
+		fmt.Fprintln(env.Out, strings.Join(path, "."))
+	}
+	return nil
+}
+
+// editSchema renames, moves, merges, deletes, archives or unarchives an
+// activity, rewriting the records logged against it to match.
+func editSchema(ctx context.Context, env *Env, op string, args []string) error {
+	fs := newFlagSet(env, "schema")
+	dryRun := fs.Bool("dry-run", false, "print what would change without changing it")
+	recordsTo := fs.String("records-to", "", "activity to move the records of a deleted activity to, instead of leaving them")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var edit *schemaedit.Edit
+	switch {
+	case op == "rename" && len(positional) == 2:
+		edit, err = schemaedit.Rename(positional[0], positional[1])
+	case op == "move" && len(positional) == 2:
+		edit, err = schemaedit.Move(positional[0], positional[1])
+	case op == "merge" && len(positional) == 2:
+		edit, err = schemaedit.Merge(positional[0], positional[1])
+	case op == "delete" && len(positional) == 1:
+		edit, err = schemaedit.Delete(positional[0], *recordsTo)
+	case op == "archive" && len(positional) == 1:
+		edit, err = schemaedit.Archive(positional[0])
+	case op == "unarchive" && len(positional) == 1:
+		edit, err = schemaedit.Unarchive(positional[0])
+	default:
+		return fmt.Errorf("usage: %s", commands()["schema"].usage)
+	}
+	if err != nil {
+		return err
+	}
+	if *recordsTo != "" && op != "delete" {
+		return fmt.Errorf("--records-to only goes with delete")
+	}
+
+	result, err := schemaedit.Apply(ctx, env.SchemaDAO, env.DataDAO, env.TimerDAO, edit, *dryRun)
+	if err != nil {
+		return fmt.Errorf("schemaedit.Apply() returns err: %w", err)
+	}
+
+	fmt.Fprintln(env.Out, result.Summary())
+	return nil
+}
@@ -0,0 +1,533 @@
+// Package config works out the effective settings from, in increasing order
+// of precedence, defaults, the config file, environment variables and flags.
+package config
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constants"
+	"activity_log/internal/atomicfile"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// envPrefix starts the environment variable of every setting, e.g. ACTIVITY_LOG_BACKEND.
+const envPrefix = "ACTIVITY_LOG_"
+
+// configFlag names the flag, and with envPrefix the environment variable,
+// that points at a config file other than the default one.
+const configFlag = "config"
+
+type Config struct {
+	Backend string
+	// Dir is where the files below live unless they're set themselves.
+	Dir string
+	// Profile picks the schema, data and timer files in Dir to use.
+	Profile              string
+	SchemaPath           string
+	DataPath             string
+	DBPath               string
+	TimerPath            string
+	ReminderSettingsPath string
+
+	// ReminderSchedule replaces the schedule saved at ReminderSettingsPath if set.
+	ReminderSchedule string
+	Notifier         string
+	NotifyCommand    string
+
+	ResponseWait        time.Duration
+	MaxConfusionRetries int
+	// MaxLastRecordWait is how long since the last record an empty answer
+	// to "how many minutes" may still log.
+	MaxLastRecordWait time.Duration
+
+	// ConfigPath is the config file that was read, or would have been if it existed.
+	ConfigPath string
+
+	// sources says where each setting's value came from, by setting name.
+	sources map[string]string
+}
+
+// underDirSource is the source of files left to default under Dir.
+const underDirSource = "default, under dir"
+
+// setting is one configurable value. Its name is its flag and its key in the
+// config file, its environment variable is the name upper cased after envPrefix.
+type setting struct {
+	name  string
+	usage string
+	// def is the default, or for files the file name under Dir.
+	def string
+	// underDir marks files, which default to def under Dir.
+	underDir bool
+	// perProfile marks files each profile has its own of, under its directory in Dir.
+	perProfile bool
+	set        func(c *Config, value string) error
+	get        func(c *Config) string
+}
+
+func settings() []*setting {
+	return []*setting{
+		{
+			name:  "backend",
+			usage: "where to keep your schema and data: csv or bolt",
+			def:   "csv",
+			set: func(c *Config, value string) error {
+				if value != "csv" && value != "bolt" {
+					return fmt.Errorf("unknown backend %q, want csv or bolt", value)
+				}
+				c.Backend = value
+				return nil
+			},
+			get: func(c *Config) string { return c.Backend },
+		},
+		{
+			name:  "dir",
+			usage: "directory holding your schema, data and settings",
+			set:   func(c *Config, value string) error { c.Dir = ExpandHome(value); return nil },
+			get:   func(c *Config) string { return c.Dir },
+		},
+		{
+			name:  "profile",
+			usage: "profile to use, each has its own schema and data",
+			def:   constants.DEFAULT_PROFILE,
+			set: func(c *Config, value string) error {
+				if err := ValidateProfile(value); err != nil {
+					return err
+				}
+				c.Profile = value
+				return nil
+			},
+			get: func(c *Config) string { return c.Profile },
+		},
+		pathSetting("schema", "schema file used by the csv backend", "schema.json", true, func(c *Config) *string { return &c.SchemaPath }),
+		pathSetting("data", "data file used by the csv backend", "data.csv", true, func(c *Config) *string { return &c.DataPath }),
+		pathSetting("db", "database file used by the bolt backend", "activity_log.db", true, func(c *Config) *string { return &c.DBPath }),
+		pathSetting("timer", "running timer file used by the csv backend", "timer.json", true, func(c *Config) *string { return &c.TimerPath }),
+		pathSetting("reminders", "file your reminder schedule is saved in", "reminders.json", false, func(c *Config) *string { return &c.ReminderSettingsPath }),
+		{
+			name:  "reminder-schedule",
+			usage: "when to remind you, e.g. \"every 30 minutes, 9:00-18:00, Mon-Fri\", instead of the saved schedule",
+			set:   func(c *Config, value string) error { c.ReminderSchedule = value; return nil },
+			get:   func(c *Config) string { return c.ReminderSchedule },
+		},
+		{
+			name:  "notifier",
+			usage: "how to remind you to log: terminal, desktop or command",
+			def:   "terminal",
+			set:   func(c *Config, value string) error { c.Notifier = value; return nil },
+			get:   func(c *Config) string { return c.Notifier },
+		},
+		{
+			name:  "notify-command",
+			usage: "command the command notifier runs, with the reminder as its last argument",
+			set:   func(c *Config, value string) error { c.NotifyCommand = value; return nil },
+			get:   func(c *Config) string { return c.NotifyCommand },
+		},
+		durationSetting("response-wait", "how long a question waits for an answer before the round is abandoned", "1m", func(c *Config) *time.Duration { return &c.ResponseWait }),
+		{
+			name:  "max-confusion-retries",
+			usage: "how often a question is asked again after an answer it can't use",
+			def:   "3",
+			set: func(c *Config, value string) error {
+				retries, err := strconv.Atoi(value)
+				if err != nil || retries < 0 {
+					return fmt.Errorf("%q isn't a number of retries", value)
+				}
+				c.MaxConfusionRetries = retries
+				return nil
+			},
+			get: func(c *Config) string { return strconv.Itoa(c.MaxConfusionRetries) },
+		},
+		durationSetting("max-last-record-wait", "how long since the last record leaving the minutes empty may still log", "1h", func(c *Config) *time.Duration { return &c.MaxLastRecordWait }),
+	}
+}
+
+// pathSetting is a file that defaults to fileName under Dir, or under the
+// profile's directory if perProfile.
+func pathSetting(name string, usage string, fileName string, perProfile bool, field func(c *Config) *string) *setting {
+	return &setting{
+		name:       name,
+		usage:      usage,
+		def:        fileName,
+		underDir:   true,
+		perProfile: perProfile,
+		set:        func(c *Config, value string) error { *field(c) = ExpandHome(value); return nil },
+		get:        func(c *Config) string { return *field(c) },
+	}
+}
+
+func durationSetting(name string, usage string, def string, field func(c *Config) *time.Duration) *setting {
+	return &setting{
+		name:  name,
+		usage: usage,
+		def:   def,
+		set: func(c *Config, value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return fmt.Errorf("%q isn't a duration like 30s or 2m", value)
+			}
+			*field(c) = d
+			return nil
+		},
+		get: func(c *Config) string { return field(c).String() },
+	}
+}
+
+func (s *setting) envVar() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+// Loader registers a flag per setting and layers them over the rest once parsed.
+type Loader struct {
+	fs         *flag.FlagSet
+	flags      map[string]*string
+	configPath *string
+}
+
+// NewLoader adds the flags of every setting to fs.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	loader := &Loader{
+		fs:         fs,
+		flags:      map[string]*string{},
+		configPath: fs.String(configFlag, "", fmt.Sprintf("config file to read instead of %s", defaultConfigPath())),
+	}
+
+	for _, s := range settings() {
+		usage := s.usage
+		if s.underDir {
+			usage = fmt.Sprintf("%s (default %q under -dir)", usage, s.def)
+		} else if s.def != "" {
+			usage = fmt.Sprintf("%s (default %q)", usage, s.def)
+		}
+		loader.flags[s.name] = fs.String(s.name, "", usage)
+	}
+
+	return loader
+}
+
+// Load returns the effective config. Call it after parsing the flag set,
+// getenv is os.Getenv outside of tests.
+func (l *Loader) Load(getenv func(string) string) (*Config, error) {
+	return l.load(getenv, true)
+}
+
+// LoadWithoutFile is Load leaving out the config file, for when it's broken.
+func (l *Loader) LoadWithoutFile(getenv func(string) string) (*Config, error) {
+	return l.load(getenv, false)
+}
+
+func (l *Loader) load(getenv func(string) string, useFile bool) (*Config, error) {
+	c := &Config{sources: map[string]string{}}
+
+	defaultDir, dirSource := defaultDir(getenv)
+	values := map[string]string{"dir": defaultDir}
+	c.sources["dir"] = dirSource
+	for _, s := range settings() {
+		if s.def != "" {
+			values[s.name] = s.def
+		}
+		if s.name != "dir" {
+			c.sources[s.name] = "default"
+		}
+	}
+
+	// The config file.
+	configPath, explicit := defaultConfigPath(), false
+	c.sources[configFlag] = "default"
+	if path := getenv(envPrefix + strings.ToUpper(configFlag)); path != "" {
+		configPath, explicit = ExpandHome(path), true
+		c.sources[configFlag] = "env " + envPrefix + strings.ToUpper(configFlag)
+	}
+	if *l.configPath != "" {
+		configPath, explicit = ExpandHome(*l.configPath), true
+		c.sources[configFlag] = "flag -" + configFlag
+	}
+	c.ConfigPath = configPath
+	if useFile {
+		fileValues, err := readFile(configPath)
+		if err != nil && (explicit || !apperror.IsNotFoundError(err)) {
+			return nil, fmt.Errorf("readFile(%s) returns err: %w", configPath, err)
+		}
+		for name, value := range fileValues {
+			values[name] = value
+			c.sources[name] = configPath
+		}
+	}
+
+	// Environment variables.
+	for _, s := range settings() {
+		if value := getenv(s.envVar()); value != "" {
+			values[s.name] = value
+			c.sources[s.name] = "env " + s.envVar()
+		}
+	}
+
+	// Flags, only the ones given.
+	l.fs.Visit(func(f *flag.Flag) {
+		if _, ok := l.flags[f.Name]; ok {
+			values[f.Name] = f.Value.String()
+			c.sources[f.Name] = "flag -" + f.Name
+		}
+	})
+
+	for _, s := range settings() {
+		value, ok := values[s.name]
+		if !ok {
+			continue
+		}
+		if s.underDir && c.sources[s.name] == "default" {
+			// Set once Dir is known.
+			continue
+		}
+		if err := s.set(c, value); err != nil {
+			return nil, fmt.Errorf("%s from %s: %w", s.name, c.sources[s.name], err)
+		}
+	}
+
+	for _, s := range settings() {
+		if s.underDir && c.sources[s.name] == "default" {
+			c.sources[s.name] = underDirSource
+		}
+	}
+	c.placeFiles()
+
+	return c, nil
+}
+
+// placeFiles points the files left to their defaults at Dir and the profile's directory in it.
+func (c *Config) placeFiles() {
+	for _, s := range settings() {
+		if !s.underDir || c.sources[s.name] != underDirSource {
+			continue
+		}
+		if s.perProfile {
+			s.set(c, filepath.Join(c.ProfileDir(c.Profile), s.def))
+		} else {
+			s.set(c, filepath.Join(c.Dir, s.def))
+		}
+	}
+}
+
+// SetDir moves Dir, and with it the files that default to living there.
+func (c *Config) SetDir(dir string, source string) {
+	c.Dir = ExpandHome(dir)
+	c.sources["dir"] = source
+	c.placeFiles()
+}
+
+// ProfileDir is the directory the files of profile default to living in.
+func (c *Config) ProfileDir(profile string) string {
+	if profile == constants.DEFAULT_PROFILE {
+		return c.Dir
+	}
+	return filepath.Join(c.Dir, constants.PROFILES_DIR, profile)
+}
+
+// ForProfile returns a copy of c using profile instead. Files set
+// explicitly stay where they are, so they're shared by every profile.
+func (c *Config) ForProfile(profile string) (*Config, error) {
+	if err := ValidateProfile(profile); err != nil {
+		return nil, err
+	}
+
+	copied := *c
+	copied.sources = map[string]string{}
+	for name, source := range c.sources {
+		copied.sources[name] = source
+	}
+	copied.Profile = profile
+	copied.placeFiles()
+
+	return &copied, nil
+}
+
+// Profiles lists the default profile and every profile created in Dir, sorted.
+func (c *Config) Profiles() ([]string, error) {
+	profiles := []string{constants.DEFAULT_PROFILE}
+
+	infos, err := ioutil.ReadDir(filepath.Join(c.Dir, constants.PROFILES_DIR))
+	if apperror.IsNotFoundError(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir(%s) returns err: %w", filepath.Join(c.Dir, constants.PROFILES_DIR), err)
+	}
+	for _, info := range infos {
+		if info.IsDir() && ValidateProfile(info.Name()) == nil && info.Name() != constants.DEFAULT_PROFILE {
+			profiles = append(profiles, info.Name())
+		}
+	}
+
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// HasProfile reports whether profile is the default one or has been created.
+func (c *Config) HasProfile(profile string) bool {
+	if profile == constants.DEFAULT_PROFILE {
+		return true
+	}
+	info, err := os.Stat(c.ProfileDir(profile))
+	return err == nil && info.IsDir()
+}
+
+// profileName is what profiles may be called, so each is a plain directory name.
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidateProfile returns an error if profile can't be a profile's name.
+func ValidateProfile(profile string) error {
+	if !profileName.MatchString(profile) {
+		return fmt.Errorf("%q can't name a profile, use lower case letters, digits, - and _", profile)
+	}
+	return nil
+}
+
+// readFile reads a config file, a JSON object of setting names to values.
+func readFile(path string) (map[string]string, error) {
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(%s) returns err: %w", path, err)
+	}
+
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(jsonBytes, &raw); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal(%s) returns err: %w", path, err)
+	}
+
+	known := map[string]bool{}
+	for _, s := range settings() {
+		known[s.name] = true
+	}
+
+	values := map[string]string{}
+	for name, value := range raw {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+		values[name] = fmt.Sprintf("%v", value)
+	}
+	return values, nil
+}
+
+// SaveFile sets values in the config file at path, keeping the settings
+// already in it. Settings in it that are unknown or have values that don't
+// parse are dropped, so saving repairs a file Load refuses, and their names
+// returned.
+func SaveFile(path string, values map[string]string) ([]string, error) {
+	raw := map[string]interface{}{}
+	if jsonBytes, err := ioutil.ReadFile(path); err == nil {
+		// A file that isn't JSON at all is replaced whole.
+		json.Unmarshal(jsonBytes, &raw)
+	}
+
+	byName := map[string]*setting{}
+	for _, s := range settings() {
+		byName[s.name] = s
+	}
+
+	merged := map[string]string{}
+	dropped := []string{}
+	for name, value := range raw {
+		s, ok := byName[name]
+		if !ok || s.set(&Config{}, fmt.Sprintf("%v", value)) != nil {
+			dropped = append(dropped, name)
+			continue
+		}
+		merged[name] = fmt.Sprintf("%v", value)
+	}
+	for name, value := range values {
+		s, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+		if err := s.set(&Config{}, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		merged[name] = value
+	}
+
+	jsonBytes, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("json.MarshalIndent(%+v) returns err: %w", merged, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll(%s) returns err: %w", filepath.Dir(path), err)
+	}
+	if err := atomicfile.Write(path, append(jsonBytes, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("atomicfile.Write(%s) returns err: %w", path, err)
+	}
+
+	sort.Strings(dropped)
+	return dropped, nil
+}
+
+// Show prints every setting with its value and where the value came from.
+func (c *Config) Show(out io.Writer) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "%s\t%s\t%s\n", configFlag, strconv.Quote(c.ConfigPath), c.sources[configFlag])
+	for _, s := range settings() {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", s.name, strconv.Quote(s.get(c)), c.sources[s.name])
+	}
+	return writer.Flush()
+}
+
+// MakeDirs creates the directories the configured files go in.
+func (c *Config) MakeDirs() error {
+	for _, path := range []string{c.SchemaPath, c.DataPath, c.DBPath, c.TimerPath, c.ReminderSettingsPath} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("os.MkdirAll(%s) returns err: %w", filepath.Dir(path), err)
+		}
+	}
+	return nil
+}
+
+// defaultConfigPath is config.json under $XDG_CONFIG_HOME/activity_log, or
+// the platform's equivalent.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "activity_log", "config.json")
+}
+
+// defaultDir is $XDG_DATA_HOME/activity_log, or ~/.local/share/activity_log
+// without it. Launched from a checkout that already has data in it, it's
+// that data's directory, so upgrading doesn't hide anything.
+func defaultDir(getenv func(string) string) (string, string) {
+	if info, err := os.Stat(constants.LEGACY_DATA_DIR); err == nil && info.IsDir() {
+		if abs, err := filepath.Abs(constants.LEGACY_DATA_DIR); err == nil {
+			return abs, fmt.Sprintf("default, found %s in the working directory", constants.LEGACY_DATA_DIR)
+		}
+	}
+
+	if dir := getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "activity_log"), "default, under $XDG_DATA_HOME"
+	}
+	return ExpandHome(filepath.Join("~", ".local", "share", "activity_log")), "default"
+}
+
+// ExpandHome replaces a leading ~ with the user's home directory.
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
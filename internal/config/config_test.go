@@ -0,0 +1,192 @@
+package config_test
+
+import (
+	"activity_log/internal/config"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"backend": "bolt", "response-wait": "2m", "max-confusion-retries": 5}`), 0644); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+
+	env := map[string]string{
+		"XDG_DATA_HOME":              dir,
+		"ACTIVITY_LOG_CONFIG":        configPath,
+		"ACTIVITY_LOG_RESPONSE_WAIT": "3m",
+		"ACTIVITY_LOG_DATA":          "/elsewhere/data.csv",
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := config.NewLoader(fs)
+	if err := fs.Parse([]string{"-response-wait", "4m"}); err != nil {
+		t.Fatalf("Parse() returns err: %v", err)
+	}
+
+	cfg, err := loader.Load(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+
+	testCases := []struct {
+		desc string
+		got  interface{}
+		want interface{}
+	}{
+		{desc: "default", got: cfg.MaxLastRecordWait, want: time.Hour},
+		{desc: "file over default", got: cfg.Backend, want: "bolt"},
+		{desc: "file only", got: cfg.MaxConfusionRetries, want: 5},
+		{desc: "env over default", got: cfg.DataPath, want: "/elsewhere/data.csv"},
+		{desc: "flag over env and file", got: cfg.ResponseWait, want: 4 * time.Minute},
+		{desc: "path under default dir", got: cfg.SchemaPath, want: filepath.Join(dir, "activity_log", "schema.json")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if tc.got != tc.want {
+				t.Errorf("Load() sets %v, want %v", tc.got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	testCases := []struct {
+		desc string
+		args []string
+		file string
+	}{
+		{
+			desc: "unknown backend",
+			args: []string{"-backend", "sqlite"},
+		},
+		{
+			desc: "bad duration",
+			args: []string{"-response-wait", "soon"},
+		},
+		{
+			desc: "unknown setting in file",
+			file: `{"colour": "blue"}`,
+		},
+		{
+			desc: "missing file that was asked for",
+			args: []string{"-config", "does-not-exist.json"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			args := tc.args
+			if tc.file != "" {
+				configPath := filepath.Join(dir, "config.json")
+				if err := ioutil.WriteFile(configPath, []byte(tc.file), 0644); err != nil {
+					t.Fatalf("WriteFile() returns err: %v", err)
+				}
+				args = append(args, "-config", configPath)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			loader := config.NewLoader(fs)
+			if err := fs.Parse(args); err != nil {
+				t.Fatalf("Parse() returns err: %v", err)
+			}
+
+			if _, err := loader.Load(func(string) string { return "" }); err == nil {
+				t.Errorf("Load() returns no err, want one")
+			}
+		})
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"backend": "bolt", "colour": "blue", "response-wait": "soon", "notifier": "desktop"}`), 0644); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+
+	dropped, err := config.SaveFile(configPath, map[string]string{"backend": "csv", "dir": "/data"})
+	if err != nil {
+		t.Fatalf("SaveFile() returns err: %v", err)
+	}
+	if got, want := strings.Join(dropped, ","), "colour,response-wait"; got != want {
+		t.Errorf("SaveFile() drops %q, want %q", got, want)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := config.NewLoader(fs)
+	if err := fs.Parse([]string{"-config", configPath}); err != nil {
+		t.Fatalf("Parse() returns err: %v", err)
+	}
+	cfg, err := loader.Load(func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+
+	testCases := []struct {
+		desc string
+		got  string
+		want string
+	}{
+		{desc: "saved over file", got: cfg.Backend, want: "csv"},
+		{desc: "saved new", got: cfg.Dir, want: "/data"},
+		{desc: "kept from file", got: cfg.Notifier, want: "desktop"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if tc.got != tc.want {
+				t.Errorf("Load() after SaveFile() sets %q, want %q", tc.got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProfilePaths(t *testing.T) {
+	dir := t.TempDir()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := config.NewLoader(fs)
+	if err := fs.Parse([]string{"-dir", dir, "-profile", "work", "-timer", "/shared/timer.json"}); err != nil {
+		t.Fatalf("Parse() returns err: %v", err)
+	}
+
+	cfg, err := loader.LoadWithoutFile(func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("LoadWithoutFile() returns err: %v", err)
+	}
+	home, err := cfg.ForProfile("default")
+	if err != nil {
+		t.Fatalf("ForProfile() returns err: %v", err)
+	}
+
+	testCases := []struct {
+		desc string
+		got  string
+		want string
+	}{
+		{desc: "profile file", got: cfg.DataPath, want: filepath.Join(dir, "profiles", "work", "data.csv")},
+		{desc: "shared file", got: cfg.ReminderSettingsPath, want: filepath.Join(dir, "reminders.json")},
+		{desc: "file set explicitly", got: cfg.TimerPath, want: "/shared/timer.json"},
+		{desc: "default profile file", got: home.DataPath, want: filepath.Join(dir, "data.csv")},
+		{desc: "default profile file set explicitly", got: home.TimerPath, want: "/shared/timer.json"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if tc.got != tc.want {
+				t.Errorf("got %q, want %q", tc.got, tc.want)
+			}
+		})
+	}
+
+	if _, err := cfg.ForProfile("../escape"); err == nil {
+		t.Errorf("ForProfile(../escape) returns no err, want one")
+	}
+}
@@ -0,0 +1,39 @@
+// Package backend opens the DAOs of the configured storage backend.
+package backend
+
+import (
+	"activity_log/api/constants"
+	"activity_log/internal/config"
+	"activity_log/internal/dao"
+	boltdao "activity_log/internal/dao/bolt_dao"
+	datadao "activity_log/internal/dao/data_dao"
+	schemadao "activity_log/internal/dao/schema_dao"
+	timerdao "activity_log/internal/dao/timer_dao"
+	"fmt"
+)
+
+type DAOs struct {
+	Schema dao.UserSchemaDAO
+	Data   dao.UserDataDAO
+	Timer  dao.TimerDAO
+}
+
+func Open(cfg *config.Config) (*DAOs, error) {
+	switch cfg.Backend {
+	case "csv":
+		return &DAOs{
+			Schema: schemadao.NewLocalSchemaDAO(cfg.SchemaPath, constants.DEFAULT_SCHEMA_BACKUPS),
+			Data:   datadao.NewDataDAO(cfg.DataPath),
+			Timer:  timerdao.NewLocalTimerDAO(cfg.TimerPath),
+		}, nil
+	case "bolt":
+		boltDAO := boltdao.NewBoltDAO(cfg.DBPath)
+		return &DAOs{
+			Schema: boltDAO,
+			Data:   boltDAO,
+			Timer:  boltDAO,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+}
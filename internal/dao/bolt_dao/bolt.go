@@ -0,0 +1,621 @@
+package boltdao
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constants"
+	"activity_log/api/constructs"
+	"activity_log/internal/dao"
+	schemadao "activity_log/internal/dao/schema_dao"
+	"activity_log/internal/util"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// lockTimeout bounds how long an operation waits for another process holding the database.
+const lockTimeout = 10 * time.Second
+
+var (
+	recordsBucket = []byte("records")
+	// byTimeBucket keys are timestamp|id.
+	byTimeBucket = []byte("by_time")
+	// byActivityBucket keys are activity|0x00|timestamp|id.
+	byActivityBucket = []byte("by_activity")
+
+	schemaBucket = []byte("schema")
+	schemaKey    = []byte("schema")
+	// revisionKey counts schema dumps, so Dump can tell the schema changed since Load.
+	revisionKey = []byte("revision")
+
+	timerBucket = []byte("timer")
+	timerKey    = []byte("running")
+)
+
+// BoltDAO keeps the schema and data of a user in a single bbolt file. The
+// file is opened per operation so several processes can take turns on it.
+type BoltDAO struct {
+	path string
+
+	// loadedRevision is the schema revision as of the last Load or Dump.
+	loadedRevision uint64
+}
+
+func NewBoltDAO(path string) *BoltDAO {
+	return &BoltDAO{
+		path: path,
+	}
+}
+
+type storedRecord struct {
+	ID          string                 `json:"id"`
+	TimestampMS int64                  `json:"timestamp_ms"`
+	StartMS     int64                  `json:"start_ms,omitempty"`
+	EndMS       int64                  `json:"end_ms,omitempty"`
+	Data        map[string]interface{} `json:"data"`
+}
+
+func (bd *BoltDAO) Load(ctx context.Context) (*constructs.UserSchema, error) {
+	var us *constructs.UserSchema
+	err := bd.view(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schemaBucket)
+		if bucket == nil || bucket.Get(schemaKey) == nil {
+			return apperror.NewNotFoundError(fmt.Errorf("no schema stored in %s", bd.path))
+		}
+
+		var err error
+		us, err = schemadao.UnmarshalUserSchema(bucket.Get(schemaKey))
+		if err != nil {
+			return fmt.Errorf("UnmarshalUserSchema() returns err: %w", err)
+		}
+
+		bd.loadedRevision = schemaRevision(bucket)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return us, nil
+}
+
+// Dump stores schema. Unless force is set, it refuses with a ConflictError
+// to overwrite a schema another process dumped since this DAO last saw it.
+func (bd *BoltDAO) Dump(ctx context.Context, schema *constructs.UserSchema, force bool) error {
+	jsonBytes, err := schemadao.MarshalUserSchema(schema)
+	if err != nil {
+		return fmt.Errorf("MarshalUserSchema() returns err: %w", err)
+	}
+
+	var revision uint64
+	if err := bd.update(ctx, func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(schemaBucket)
+		if err != nil {
+			return fmt.Errorf("CreateBucketIfNotExists(%s) returns err: %w", schemaBucket, err)
+		}
+
+		revision = schemaRevision(bucket)
+		if !force && bucket.Get(schemaKey) != nil && revision != bd.loadedRevision {
+			return apperror.NewConflictError(fmt.Errorf("schema in %s changed since it was loaded", bd.path))
+		}
+
+		revision++
+		if err := bucket.Put(revisionKey, uint64Key(revision)); err != nil {
+			return fmt.Errorf("Put(%s) returns err: %w", revisionKey, err)
+		}
+		return bucket.Put(schemaKey, jsonBytes)
+	}); err != nil {
+		return err
+	}
+
+	bd.loadedRevision = revision
+
+	return nil
+}
+
+// HasChanged reports whether the schema was dumped since this DAO last loaded or dumped it.
+func (bd *BoltDAO) HasChanged(ctx context.Context) (bool, error) {
+	var revision uint64
+	if err := bd.view(ctx, func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(schemaBucket); bucket != nil {
+			revision = schemaRevision(bucket)
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	return revision != bd.loadedRevision, nil
+}
+
+func schemaRevision(bucket *bolt.Bucket) uint64 {
+	revision := bucket.Get(revisionKey)
+	if revision == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(revision)
+}
+
+func (bd *BoltDAO) Init(ctx context.Context) (*constructs.UserSchema, error) {
+	defaultUserMap, err := util.NewExpandingMap(constants.DEFAULT_USER_SCHEMA)
+	if err != nil {
+		return nil, fmt.Errorf("NewExpandingMap returns err: %v", err)
+	}
+
+	defaultUserSchema := &constructs.UserSchema{
+		Schema: defaultUserMap,
+	}
+
+	return defaultUserSchema, bd.Dump(ctx, defaultUserSchema, true)
+}
+
+func (bd *BoltDAO) Append(ctx context.Context, data *constructs.UserData) error {
+	return bd.AppendAll(ctx, []*constructs.UserData{data})
+}
+
+// AppendAll stores every record of data in a single transaction. Records that
+// already have an ID replace the stored record with that ID.
+func (bd *BoltDAO) AppendAll(ctx context.Context, data []*constructs.UserData) error {
+	for _, record := range data {
+		if record.ID != "" {
+			continue
+		}
+
+		var err error
+		if record.ID, err = constructs.NewUserDataID(); err != nil {
+			return fmt.Errorf("NewUserDataID() returns err: %w", err)
+		}
+	}
+
+	return bd.update(ctx, func(tx *bolt.Tx) error {
+		for _, record := range data {
+			if err := deleteRecord(tx, record.ID); err != nil && !apperror.IsNotFoundError(err) {
+				return fmt.Errorf("deleteRecord(%s) returns err: %w", record.ID, err)
+			}
+			if err := putRecord(tx, record); err != nil {
+				return fmt.Errorf("putRecord(%s) returns err: %w", record.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (bd *BoltDAO) Update(ctx context.Context, data *constructs.UserData) error {
+	if data.ID == "" {
+		return fmt.Errorf("cannot update a record without an ID")
+	}
+
+	return bd.update(ctx, func(tx *bolt.Tx) error {
+		if err := deleteRecord(tx, data.ID); err != nil {
+			return fmt.Errorf("deleteRecord(%s) returns err: %w", data.ID, err)
+		}
+		return putRecord(tx, data)
+	})
+}
+
+func (bd *BoltDAO) Delete(ctx context.Context, id string) error {
+	return bd.update(ctx, func(tx *bolt.Tx) error {
+		return deleteRecord(tx, id)
+	})
+}
+
+// RewriteActivities rewrites every record in a single transaction.
+func (bd *BoltDAO) RewriteActivities(ctx context.Context, rewrite func(activity string) (string, bool), dryRun bool) ([]*constructs.UserData, error) {
+	if dryRun {
+		records, err := bd.List(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("List() returns err: %w", err)
+		}
+		return dao.ChangedActivities(records, rewrite), nil
+	}
+
+	changed := []*constructs.UserData{}
+	err := bd.update(ctx, func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		if records == nil {
+			return nil
+		}
+
+		// Collected first, the bucket can't change under its cursor.
+		if err := records.ForEach(func(_ []byte, jsonBytes []byte) error {
+			record, err := decodeRecord(jsonBytes)
+			if err != nil {
+				return fmt.Errorf("decodeRecord() returns err: %w", err)
+			}
+			if to, ok := rewrite(record.ActivityPath()); ok && to != record.ActivityPath() {
+				changed = append(changed, record)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, record := range changed {
+			to, _ := rewrite(record.ActivityPath())
+			rewritten := &constructs.UserData{
+				ID:          record.ID,
+				Data:        map[string]interface{}{},
+				TimestampMS: record.TimestampMS,
+				StartMS:     record.StartMS,
+				EndMS:       record.EndMS,
+			}
+			for key, val := range record.Data {
+				rewritten.Data[key] = val
+			}
+			rewritten.Data[string(constructs.Activity)] = to
+
+			if err := deleteRecord(tx, record.ID); err != nil {
+				return fmt.Errorf("deleteRecord(%s) returns err: %w", record.ID, err)
+			}
+			if err := putRecord(tx, rewritten); err != nil {
+				return fmt.Errorf("putRecord(%s) returns err: %w", record.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(changed, func(i, j int) bool { return changed[i].TimestampMS < changed[j].TimestampMS })
+	return changed, nil
+}
+
+func (bd *BoltDAO) List(ctx context.Context, filter *constructs.UserDataFilter) ([]*constructs.UserData, error) {
+	it, err := bd.Iterate(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("Iterate() returns err: %w", err)
+	}
+	defer it.Close()
+
+	output := []*constructs.UserData{}
+	for it.Next() {
+		output = append(output, it.UserData())
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("iterating %s returns err: %w", bd.path, err)
+	}
+
+	sort.SliceStable(output, func(i, j int) bool { return output[i].TimestampMS < output[j].TimestampMS })
+
+	return output, nil
+}
+
+// Iterate walks the activity index when filter has an ActivityPrefix and the
+// time index otherwise.
+func (bd *BoltDAO) Iterate(ctx context.Context, filter *constructs.UserDataFilter) (dao.UserDataIterator, error) {
+	db, err := bd.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin(false)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Begin() returns err: %w", err)
+	}
+
+	it := &boltIterator{
+		ctx:    ctx,
+		db:     db,
+		tx:     tx,
+		filter: filter,
+	}
+
+	if filter != nil && filter.ActivityPrefix != "" {
+		it.prefix = []byte(filter.ActivityPrefix)
+		if bucket := tx.Bucket(byActivityBucket); bucket != nil {
+			it.cursor = bucket.Cursor()
+		}
+	} else if bucket := tx.Bucket(byTimeBucket); bucket != nil {
+		it.cursor = bucket.Cursor()
+		if filter != nil && filter.SinceMS != 0 {
+			it.prefix = timestampKey(filter.SinceMS)
+		}
+	}
+
+	return it, nil
+}
+
+func (bd *BoltDAO) open(ctx context.Context) (*bolt.DB, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(bd.path, 0600, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("bolt.Open(%s) returns err: %w", bd.path, err)
+	}
+	return db, nil
+}
+
+func (bd *BoltDAO) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	db, err := bd.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(fn)
+}
+
+func (bd *BoltDAO) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	db, err := bd.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(fn)
+}
+
+func putRecord(tx *bolt.Tx, data *constructs.UserData) error {
+	jsonBytes, err := json.Marshal(&storedRecord{
+		ID:          data.ID,
+		TimestampMS: data.TimestampMS,
+		StartMS:     data.StartMS,
+		EndMS:       data.EndMS,
+		Data:        data.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("json.Marshal(%+v) returns err: %w", data, err)
+	}
+
+	for _, entry := range []struct {
+		bucket []byte
+		key    []byte
+		value  []byte
+	}{
+		{bucket: recordsBucket, key: []byte(data.ID), value: jsonBytes},
+		{bucket: byTimeBucket, key: timeIndexKey(data)},
+		{bucket: byActivityBucket, key: activityIndexKey(data)},
+	} {
+		bucket, err := tx.CreateBucketIfNotExists(entry.bucket)
+		if err != nil {
+			return fmt.Errorf("CreateBucketIfNotExists(%s) returns err: %w", entry.bucket, err)
+		}
+		if err := bucket.Put(entry.key, entry.value); err != nil {
+			return fmt.Errorf("Put() into %s returns err: %w", entry.bucket, err)
+		}
+	}
+
+	return nil
+}
+
+func deleteRecord(tx *bolt.Tx, id string) error {
+	records := tx.Bucket(recordsBucket)
+	if records == nil || records.Get([]byte(id)) == nil {
+		return apperror.NewNotFoundError(fmt.Errorf("no record with ID %q", id))
+	}
+
+	data, err := decodeRecord(records.Get([]byte(id)))
+	if err != nil {
+		return fmt.Errorf("decodeRecord(%s) returns err: %w", id, err)
+	}
+
+	if err := records.Delete([]byte(id)); err != nil {
+		return fmt.Errorf("Delete() from %s returns err: %w", recordsBucket, err)
+	}
+	if err := tx.Bucket(byTimeBucket).Delete(timeIndexKey(data)); err != nil {
+		return fmt.Errorf("Delete() from %s returns err: %w", byTimeBucket, err)
+	}
+	if err := tx.Bucket(byActivityBucket).Delete(activityIndexKey(data)); err != nil {
+		return fmt.Errorf("Delete() from %s returns err: %w", byActivityBucket, err)
+	}
+
+	return nil
+}
+
+func decodeRecord(jsonBytes []byte) (*constructs.UserData, error) {
+	var stored storedRecord
+	if err := json.Unmarshal(jsonBytes, &stored); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal returns err: %w", err)
+	}
+
+	// JSON has no integers, restore the type Append was given.
+	if minutes, ok := stored.Data[string(constructs.MinutesSpent)].(float64); ok {
+		stored.Data[string(constructs.MinutesSpent)] = int(minutes)
+	}
+
+	return &constructs.UserData{
+		ID:          stored.ID,
+		Data:        stored.Data,
+		TimestampMS: stored.TimestampMS,
+		StartMS:     stored.StartMS,
+		EndMS:       stored.EndMS,
+	}, nil
+}
+
+func timestampKey(timestampMS int64) []byte {
+	return uint64Key(uint64(timestampMS))
+}
+
+// uint64Key encodes v so that keys sort numerically.
+func uint64Key(v uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, v)
+	return key
+}
+
+func timeIndexKey(data *constructs.UserData) []byte {
+	return append(timestampKey(data.TimestampMS), data.ID...)
+}
+
+func activityIndexKey(data *constructs.UserData) []byte {
+	key := append([]byte(data.ActivityPath()), 0)
+	return append(key, timeIndexKey(data)...)
+}
+
+type boltIterator struct {
+	ctx    context.Context
+	db     *bolt.DB
+	tx     *bolt.Tx
+	cursor *bolt.Cursor
+	filter *constructs.UserDataFilter
+	// prefix is where the cursor starts. For the activity index it also bounds the scan.
+	prefix []byte
+
+	started bool
+	current *constructs.UserData
+	err     error
+}
+
+func (bi *boltIterator) Next() bool {
+	if bi.cursor == nil || bi.err != nil {
+		return false
+	}
+
+	for {
+		if err := bi.ctx.Err(); err != nil {
+			bi.err = err
+			return false
+		}
+
+		var key []byte
+		if !bi.started {
+			bi.started = true
+			if bi.prefix != nil {
+				key, _ = bi.cursor.Seek(bi.prefix)
+			} else {
+				key, _ = bi.cursor.First()
+			}
+		} else {
+			key, _ = bi.cursor.Next()
+		}
+
+		if key == nil {
+			return false
+		}
+
+		usingActivityIndex := bi.filter != nil && bi.filter.ActivityPrefix != ""
+		if usingActivityIndex && !bytes.HasPrefix(key, bi.prefix) {
+			return false
+		}
+		if !usingActivityIndex && bi.filter != nil && bi.filter.UntilMS != 0 &&
+			int64(binary.BigEndian.Uint64(key[:8])) >= bi.filter.UntilMS {
+			return false
+		}
+
+		id := key[8:]
+		if usingActivityIndex {
+			// Activities never contain 0x00, so the first one ends the activity.
+			id = key[bytes.IndexByte(key, 0)+9:]
+		}
+
+		data, err := decodeRecord(bi.tx.Bucket(recordsBucket).Get(id))
+		if err != nil {
+			bi.err = fmt.Errorf("decodeRecord(%s) returns err: %w", id, err)
+			return false
+		}
+
+		if bi.filter.Matches(data) {
+			bi.current = data
+			return true
+		}
+	}
+}
+
+func (bi *boltIterator) UserData() *constructs.UserData {
+	return bi.current
+}
+
+func (bi *boltIterator) Err() error {
+	return bi.err
+}
+
+func (bi *boltIterator) Close() error {
+	if err := bi.tx.Rollback(); err != nil {
+		bi.db.Close()
+		return fmt.Errorf("Rollback() returns err: %w", err)
+	}
+	return bi.db.Close()
+}
+
+type storedTimer struct {
+	Activity string `json:"activity"`
+	StartMS  int64  `json:"start_ms"`
+}
+
+func (bd *BoltDAO) LoadTimer(ctx context.Context) (*constructs.Timer, error) {
+	var timer *constructs.Timer
+	err := bd.view(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(timerBucket)
+		if bucket == nil || bucket.Get(timerKey) == nil {
+			return apperror.NewNotFoundError(fmt.Errorf("no timer running in %s", bd.path))
+		}
+
+		stored := &storedTimer{}
+		if err := json.Unmarshal(bucket.Get(timerKey), stored); err != nil {
+			return fmt.Errorf("json.Unmarshal() returns err: %w", err)
+		}
+
+		timer = &constructs.Timer{
+			Activity: stored.Activity,
+			StartMS:  stored.StartMS,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return timer, nil
+}
+
+func (bd *BoltDAO) SaveTimer(ctx context.Context, timer *constructs.Timer) error {
+	jsonBytes, err := json.Marshal(&storedTimer{
+		Activity: timer.Activity,
+		StartMS:  timer.StartMS,
+	})
+	if err != nil {
+		return fmt.Errorf("json.Marshal(%+v) returns err: %w", timer, err)
+	}
+
+	return bd.update(ctx, func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(timerBucket)
+		if err != nil {
+			return fmt.Errorf("CreateBucketIfNotExists(%s) returns err: %w", timerBucket, err)
+		}
+		return bucket.Put(timerKey, jsonBytes)
+	})
+}
+
+func (bd *BoltDAO) ClearTimer(ctx context.Context) error {
+	return bd.update(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(timerBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete(timerKey)
+	})
+}
+
+// Import copies the schema and every record out of another pair of DAOs,
+// typically the local JSON/CSV ones. Records keep their IDs, so importing
+// the same source twice doesn't duplicate anything.
+func (bd *BoltDAO) Import(ctx context.Context, schemaDAO dao.UserSchemaDAO, dataDAO dao.UserDataDAO) (int, error) {
+	us, err := schemaDAO.Load(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("schemaDAO.Load() returns err: %w", err)
+	}
+
+	records, err := dataDAO.List(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("dataDAO.List() returns err: %w", err)
+	}
+
+	if err := bd.Dump(ctx, us, true); err != nil {
+		return 0, fmt.Errorf("Dump() returns err: %w", err)
+	}
+
+	if err := bd.AppendAll(ctx, records); err != nil {
+		return 0, fmt.Errorf("AppendAll() returns err: %w", err)
+	}
+
+	return len(records), nil
+}
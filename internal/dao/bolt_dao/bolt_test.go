@@ -0,0 +1,276 @@
+package boltdao_test
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	boltdao "activity_log/internal/dao/bolt_dao"
+	datadao "activity_log/internal/dao/data_dao"
+	schemadao "activity_log/internal/dao/schema_dao"
+	"activity_log/internal/util"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRecord(activity string, minutes int, timestampMS int64) *constructs.UserData {
+	return &constructs.UserData{
+		Data: map[string]interface{}{
+			string(constructs.Activity):     activity,
+			string(constructs.MinutesSpent): minutes,
+		},
+		TimestampMS: timestampMS,
+	}
+}
+
+func TestList(t *testing.T) {
+	bd := boltdao.NewBoltDAO(filepath.Join(t.TempDir(), "activity_log.db"))
+
+	// Appended out of order on purpose, List sorts by timestamp.
+	for _, record := range []*constructs.UserData{
+		newRecord("working.coding.debugging", 20, 2000),
+		newRecord("working.coding", 10, 1000),
+		newRecord("SideProject", 40, 4000),
+		newRecord("working.codingX", 30, 3000),
+	} {
+		if err := bd.Append(context.Background(), record); err != nil {
+			t.Fatalf("Append(%+v) returns err: %v", record, err)
+		}
+	}
+
+	testCases := []struct {
+		desc        string
+		filter      *constructs.UserDataFilter
+		wantMinutes []int
+	}{
+		{
+			desc:        "nil filter",
+			filter:      nil,
+			wantMinutes: []int{10, 20, 30, 40},
+		},
+		{
+			desc:        "time range",
+			filter:      &constructs.UserDataFilter{SinceMS: 2000, UntilMS: 4000},
+			wantMinutes: []int{20, 30},
+		},
+		{
+			desc:        "activity prefix",
+			filter:      &constructs.UserDataFilter{ActivityPrefix: "working.coding"},
+			wantMinutes: []int{10, 20},
+		},
+		{
+			desc:        "time range and prefix",
+			filter:      &constructs.UserDataFilter{SinceMS: 1500, ActivityPrefix: "working"},
+			wantMinutes: []int{20, 30},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := bd.List(context.Background(), tc.filter)
+			if err != nil {
+				t.Fatalf("List() returns err: %v", err)
+			}
+
+			if len(got) != len(tc.wantMinutes) {
+				t.Fatalf("List() returns %d records, want %d", len(got), len(tc.wantMinutes))
+			}
+
+			for idx, record := range got {
+				minutes, err := record.Minutes()
+				if err != nil {
+					t.Fatalf("Minutes() returns err: %v", err)
+				}
+				if minutes != tc.wantMinutes[idx] {
+					t.Errorf("record %d has %d minutes, want %d", idx, minutes, tc.wantMinutes[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	bd := boltdao.NewBoltDAO(filepath.Join(t.TempDir(), "activity_log.db"))
+
+	first := newRecord("working.coding", 10, 1000)
+	second := newRecord("working.meeting", 20, 2000)
+	for _, record := range []*constructs.UserData{first, second} {
+		if err := bd.Append(context.Background(), record); err != nil {
+			t.Fatalf("Append(%+v) returns err: %v", record, err)
+		}
+	}
+
+	first.Data[string(constructs.Activity)] = "working.meeting"
+	if err := bd.Update(context.Background(), first); err != nil {
+		t.Fatalf("Update() returns err: %v", err)
+	}
+
+	got, err := bd.List(context.Background(), &constructs.UserDataFilter{ActivityPrefix: "working.coding"})
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Update() left a stale activity index entry: %+v", got)
+	}
+
+	if err := bd.Delete(context.Background(), second.ID); err != nil {
+		t.Fatalf("Delete() returns err: %v", err)
+	}
+
+	got, err = bd.List(context.Background(), &constructs.UserDataFilter{ActivityPrefix: "working.meeting"})
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != first.ID {
+		t.Errorf("List() after Delete() returns %+v", got)
+	}
+
+	if err := bd.Delete(context.Background(), second.ID); !apperror.IsNotFoundError(err) {
+		t.Errorf("Delete() of a missing record returns %v, want a NotFoundError", err)
+	}
+}
+
+func TestRewriteActivities(t *testing.T) {
+	bd := boltdao.NewBoltDAO(filepath.Join(t.TempDir(), "activity_log.db"))
+	for _, record := range []*constructs.UserData{
+		newRecord("working.coding", 10, 1000),
+		newRecord("working.coding.debugging", 20, 2000),
+		newRecord("working.codingX", 30, 3000),
+	} {
+		if err := bd.Append(context.Background(), record); err != nil {
+			t.Fatalf("Append(%+v) returns err: %v", record, err)
+		}
+	}
+
+	rewrite := func(activity string) (string, bool) {
+		if !constructs.ActivityHasPrefix(activity, "working.coding") {
+			return "", false
+		}
+		return "programming" + strings.TrimPrefix(activity, "working.coding"), true
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		changed, err := bd.RewriteActivities(context.Background(), rewrite, dryRun)
+		if err != nil {
+			t.Fatalf("RewriteActivities(%v) returns err: %v", dryRun, err)
+		}
+		if len(changed) != 2 || changed[0].ActivityPath() != "working.coding" || changed[1].ActivityPath() != "working.coding.debugging" {
+			t.Errorf("RewriteActivities(%v) returns %+v, want the two working.coding records as they were", dryRun, changed)
+		}
+	}
+
+	for prefix, want := range map[string]int{"working.coding": 0, "programming": 2, "working.codingX": 1} {
+		got, err := bd.List(context.Background(), &constructs.UserDataFilter{ActivityPrefix: prefix})
+		if err != nil {
+			t.Fatalf("List() returns err: %v", err)
+		}
+		if len(got) != want {
+			t.Errorf("List() under %s returns %d records, want %d", prefix, len(got), want)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+
+	schemaMap, err := util.NewExpandingMap(map[string]interface{}{
+		"default": nil,
+		"working": map[string]interface{}{"coding": nil},
+	})
+	if err != nil {
+		t.Fatalf("NewExpandingMap() returns err: %v", err)
+	}
+	schemaDAO := schemadao.NewLocalSchemaDAO(filepath.Join(dir, "schema.json"), 0)
+	if err := schemaDAO.Dump(context.Background(), &constructs.UserSchema{Schema: schemaMap}, true); err != nil {
+		t.Fatalf("Dump() returns err: %v", err)
+	}
+
+	dataDAO := datadao.NewDataDAO(filepath.Join(dir, "data.csv"))
+	for _, record := range []*constructs.UserData{
+		newRecord("working.coding", 10, 1000),
+		newRecord("working.coding", 20, 2000),
+	} {
+		if err := dataDAO.Append(context.Background(), record); err != nil {
+			t.Fatalf("Append(%+v) returns err: %v", record, err)
+		}
+	}
+
+	bd := boltdao.NewBoltDAO(filepath.Join(dir, "activity_log.db"))
+	if _, err := bd.Load(context.Background()); !apperror.IsNotFoundError(err) {
+		t.Fatalf("Load() of an empty database returns %v, want a NotFoundError", err)
+	}
+
+	// Importing twice must not duplicate records.
+	for i := 0; i < 2; i++ {
+		imported, err := bd.Import(context.Background(), schemaDAO, dataDAO)
+		if err != nil {
+			t.Fatalf("Import() returns err: %v", err)
+		}
+		if imported != 2 {
+			t.Errorf("Import() returns %d, want 2", imported)
+		}
+	}
+
+	records, err := bd.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("List() after Import() returns %d records, want 2", len(records))
+	}
+
+	us, err := bd.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+	if err := schemaMap.IsEqual(us.Schema); err != nil {
+		t.Errorf("imported schema differs: %v", err)
+	}
+}
+
+func TestSpanRoundTrip(t *testing.T) {
+	bd := boltdao.NewBoltDAO(filepath.Join(t.TempDir(), "activity_log.db"))
+
+	record := newRecord("working.meeting", 60, 0)
+	record.SetSpan(time.Unix(0, 0).Add(10*time.Hour), time.Unix(0, 0).Add(11*time.Hour))
+	if err := bd.Append(context.Background(), record); err != nil {
+		t.Fatalf("Append() returns err: %v", err)
+	}
+
+	got, err := bd.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	if len(got) != 1 || got[0].StartMS != record.StartMS || got[0].EndMS != record.EndMS || got[0].TimestampMS != record.EndMS {
+		t.Errorf("List() returns %+v, want the span of %+v", got, record)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	bd := boltdao.NewBoltDAO(filepath.Join(t.TempDir(), "activity_log.db"))
+
+	if _, err := bd.LoadTimer(context.Background()); !apperror.IsNotFoundError(err) {
+		t.Fatalf("LoadTimer() before any timer returns %v, want a NotFoundError", err)
+	}
+
+	want := &constructs.Timer{Activity: "working.coding", StartMS: 1000}
+	if err := bd.SaveTimer(context.Background(), want); err != nil {
+		t.Fatalf("SaveTimer() returns err: %v", err)
+	}
+
+	got, err := bd.LoadTimer(context.Background())
+	if err != nil {
+		t.Fatalf("LoadTimer() returns err: %v", err)
+	}
+	if *got != *want {
+		t.Errorf("LoadTimer() returns %+v, want %+v", got, want)
+	}
+
+	if err := bd.ClearTimer(context.Background()); err != nil {
+		t.Fatalf("ClearTimer() returns err: %v", err)
+	}
+	if _, err := bd.LoadTimer(context.Background()); !apperror.IsNotFoundError(err) {
+		t.Errorf("LoadTimer() after ClearTimer() returns %v, want a NotFoundError", err)
+	}
+}
@@ -1,13 +1,69 @@
 package dao
 
-import "activity_log/api/constructs"
+import (
+	"activity_log/api/constructs"
+	"context"
+)
 
 type UserSchemaDAO interface {
-	Load() (*constructs.UserSchema, error)
-	Dump(schema *constructs.UserSchema, force bool) error
-	Init() (*constructs.UserSchema, error)
+	Load(ctx context.Context) (*constructs.UserSchema, error)
+	// Dump stores schema. Unless force is set, it returns an apperror.ConflictError
+	// instead of overwriting a schema that changed since the last Load or Dump.
+	Dump(ctx context.Context, schema *constructs.UserSchema, force bool) error
+	Init(ctx context.Context) (*constructs.UserSchema, error)
+	// HasChanged reports whether the stored schema changed since the last Load or Dump.
+	HasChanged(ctx context.Context) (bool, error)
 }
 
 type UserDataDAO interface {
-	Append(data *constructs.UserData) error
+	// Append assigns data an ID if it doesn't have one yet and stores it.
+	Append(ctx context.Context, data *constructs.UserData) error
+	// Update replaces the record with data.ID.
+	Update(ctx context.Context, data *constructs.UserData) error
+	// Delete removes the record with id.
+	Delete(ctx context.Context, id string) error
+	// List returns every record matching filter, oldest first. A nil filter matches everything.
+	List(ctx context.Context, filter *constructs.UserDataFilter) ([]*constructs.UserData, error)
+	// Iterate streams the records matching filter in an order of the backend's
+	// choosing, stopping with ctx.Err() once ctx is done. Callers must Close the iterator.
+	Iterate(ctx context.Context, filter *constructs.UserDataFilter) (UserDataIterator, error)
+	// RewriteActivities sets the activity of every record to what rewrite
+	// returns for it, all records or none, and returns the records it changes
+	// as they were, oldest first. rewrite returns false to leave an activity
+	// as it is. With dryRun nothing is stored.
+	RewriteActivities(ctx context.Context, rewrite func(activity string) (string, bool), dryRun bool) ([]*constructs.UserData, error)
+}
+
+// TimerDAO keeps the running timer, so it outlives the process that started it.
+type TimerDAO interface {
+	// LoadTimer returns an apperror.NotFoundError if no timer is running.
+	LoadTimer(ctx context.Context) (*constructs.Timer, error)
+	SaveTimer(ctx context.Context, timer *constructs.Timer) error
+	// ClearTimer stops the running timer, if any.
+	ClearTimer(ctx context.Context) error
+}
+
+// UserDataIterator is used like bufio.Scanner:
+//
+//	for it.Next() {
+//		data := it.UserData()
+//	}
+//	if err := it.Err(); err != nil {
+type UserDataIterator interface {
+	Next() bool
+	UserData() *constructs.UserData
+	Err() error
+	Close() error
+}
+
+// ChangedActivities returns the records whose activity rewrite changes, for
+// RewriteActivities to preview.
+func ChangedActivities(records []*constructs.UserData, rewrite func(activity string) (string, bool)) []*constructs.UserData {
+	changed := []*constructs.UserData{}
+	for _, record := range records {
+		if to, ok := rewrite(record.ActivityPath()); ok && to != record.ActivityPath() {
+			changed = append(changed, record)
+		}
+	}
+	return changed
 }
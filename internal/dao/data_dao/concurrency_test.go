@@ -0,0 +1,95 @@
+package datadao_test
+
+import (
+	datadao "activity_log/internal/dao/data_dao"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	appenderPathEnv   = "ACTIVITY_LOG_TEST_APPENDER_PATH"
+	appenderWriterEnv = "ACTIVITY_LOG_TEST_APPENDER_WRITER"
+
+	concurrentWriters = 4
+	appendsPerWriter  = 25
+)
+
+// TestHelperAppender is the body of each writer process spawned by TestConcurrentAppends.
+func TestHelperAppender(t *testing.T) {
+	path := os.Getenv(appenderPathEnv)
+	if path == "" {
+		t.Skip("only runs as a writer process of TestConcurrentAppends")
+	}
+
+	dd := datadao.NewDataDAO(path)
+	for i := 0; i < appendsPerWriter; i++ {
+		record := newRecord("working.coding", i, int64(i))
+		// Every writer adds the same new column, so they also race to extend the header.
+		record.Data["WRITER"] = os.Getenv(appenderWriterEnv)
+		if err := dd.Append(context.Background(), record); err != nil {
+			t.Fatalf("Append() returns err: %v", err)
+		}
+	}
+}
+
+func TestConcurrentAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+
+	// Start from a header-less file so the writers race on the migration too.
+	if err := ioutil.WriteFile(path, []byte("1636662408470,working.SideProject,360,\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+
+	cmds := []*exec.Cmd{}
+	for writer := 0; writer < concurrentWriters; writer++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperAppender$")
+		cmd.Env = append(os.Environ(),
+			fmt.Sprintf("%s=%s", appenderPathEnv, path),
+			fmt.Sprintf("%s=%d", appenderWriterEnv, writer),
+		)
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Start() returns err: %v", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("writer process failed: %v", err)
+		}
+	}
+
+	records, err := datadao.NewDataDAO(path).List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+
+	wantRecords := 1 + concurrentWriters*appendsPerWriter
+	if len(records) != wantRecords {
+		t.Fatalf("List() returns %d records, want %d", len(records), wantRecords)
+	}
+
+	ids := map[string]bool{}
+	perWriter := map[interface{}]int{}
+	for _, record := range records {
+		if ids[record.ID] {
+			t.Errorf("ID %q used twice", record.ID)
+		}
+		ids[record.ID] = true
+
+		if record.ActivityPath() == "working.coding" {
+			perWriter[record.Data["WRITER"]]++
+		}
+	}
+
+	for writer := 0; writer < concurrentWriters; writer++ {
+		if got := perWriter[fmt.Sprintf("%d", writer)]; got != appendsPerWriter {
+			t.Errorf("writer %d has %d records, want %d", writer, got, appendsPerWriter)
+		}
+	}
+}
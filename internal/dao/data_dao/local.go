@@ -3,11 +3,39 @@ package datadao
 import (
 	"activity_log/api/apperror"
 	"activity_log/api/constructs"
+	"activity_log/internal/atomicfile"
+	"activity_log/internal/dao"
+	"activity_log/internal/filelock"
+	"bytes"
+	"context"
+	"encoding/csv"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"sort"
+	"strconv"
 )
 
+const (
+	// TimestampColumn heads the first column of the data file.
+	TimestampColumn = "TIMESTAMP_MS"
+	// IDColumn holds UserData.ID and always follows TimestampColumn.
+	IDColumn = "ID"
+	// StartColumn and EndColumn hold UserData.StartMS and EndMS. Like data
+	// keys, they're added to the header by the first record that has them.
+	StartColumn = "START_MS"
+	EndColumn   = "END_MS"
+)
+
+// legacyColumns are the data keys of a header-less row, in the sorted order Append used to write them.
+var legacyColumns = []string{
+	string(constructs.Activity),
+	string(constructs.MinutesSpent),
+}
+
+// DataDAO keeps records in a CSV file. Writers hold an exclusive file lock
+// and readers a shared one, so several processes can share the file.
 type DataDAO struct {
 	path string
 }
@@ -18,36 +46,585 @@ func NewDataDAO(path string) *DataDAO {
 	}
 }
 
-// TODO(luca): take column headers into consideration
-func (dd *DataDAO) Append(data *constructs.UserData) error {
+// Append writes data as a row under the file's header. Keys without a column
+// extend the header, leaving the new column empty for older rows.
+func (dd *DataDAO) Append(ctx context.Context, data *constructs.UserData) error {
+	lock, err := filelock.Exclusive(ctx, dd.path)
+	if err != nil {
+		return fmt.Errorf("filelock.Exclusive() returns err: %w", err)
+	}
+	defer lock.Unlock()
+
+	header, err := dd.ensureFormat()
+	if err != nil {
+		if !apperror.IsNotFoundError(err) {
+			return fmt.Errorf("ensureFormat() returns err: %w", err)
+		}
+
+		// TODO(luca): log this to messenger
+		// Not to stdout, where subcommands like log write what scripts read.
+		log.Printf("No data file found at %q. Creating one.", dd.path)
+		header = currentHeader()
+		if err := writeRows(dd.path, [][]string{header}); err != nil {
+			return fmt.Errorf("writeRows(%s) returns err: %w", dd.path, err)
+		}
+	}
+
+	header, err = dd.ensureColumns(header, data)
+	if err != nil {
+		return fmt.Errorf("ensureColumns() returns err: %w", err)
+	}
+
+	if data.ID == "" {
+		if data.ID, err = constructs.NewUserDataID(); err != nil {
+			return fmt.Errorf("NewUserDataID() returns err: %w", err)
+		}
+	}
+
 	f, err := os.OpenFile(dd.path, os.O_APPEND|os.O_WRONLY, 0600)
 	if err != nil {
-		if apperror.IsNotFoundError(err) {
-			// TODO(luca): log this to messenger
-			fmt.Printf("No data file found at %sq. Creating one.\n", dd.path)
-			f, err = os.OpenFile(dd.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	defer f.Close()
+
+	writer := csv.NewWriter(f)
+	if err := writer.Write(toRow(header, data)); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	return f.Close()
+}
+
+func (dd *DataDAO) Update(ctx context.Context, data *constructs.UserData) error {
+	if data.ID == "" {
+		return fmt.Errorf("cannot update a record without an ID")
+	}
+
+	lock, err := filelock.Exclusive(ctx, dd.path)
+	if err != nil {
+		return fmt.Errorf("filelock.Exclusive() returns err: %w", err)
+	}
+	defer lock.Unlock()
+
+	header, err := dd.ensureFormat()
+	if err != nil {
+		return fmt.Errorf("ensureFormat() returns err: %w", err)
+	}
+
+	header, err = dd.ensureColumns(header, data)
+	if err != nil {
+		return fmt.Errorf("ensureColumns() returns err: %w", err)
+	}
+
+	return dd.rewrite(func(rows [][]string) ([][]string, error) {
+		for idx, row := range rows[1:] {
+			// Short rows have no ID to match.
+			if len(row) > 1 && row[1] == data.ID {
+				rows[idx+1] = toRow(header, data)
+				return rows, nil
+			}
+		}
+		return nil, apperror.NewNotFoundError(fmt.Errorf("no record with ID %q", data.ID))
+	})
+}
+
+func (dd *DataDAO) Delete(ctx context.Context, id string) error {
+	lock, err := filelock.Exclusive(ctx, dd.path)
+	if err != nil {
+		return fmt.Errorf("filelock.Exclusive() returns err: %w", err)
+	}
+	defer lock.Unlock()
+
+	if _, err := dd.ensureFormat(); err != nil {
+		return fmt.Errorf("ensureFormat() returns err: %w", err)
+	}
+
+	return dd.rewrite(func(rows [][]string) ([][]string, error) {
+		for idx, row := range rows[1:] {
+			if len(row) > 1 && row[1] == id {
+				return append(rows[:idx+1], rows[idx+2:]...), nil
+			}
+		}
+		return nil, apperror.NewNotFoundError(fmt.Errorf("no record with ID %q", id))
+	})
+}
+
+// RewriteActivities rewrites the whole file at once, so readers see either
+// every activity rewritten or none.
+func (dd *DataDAO) RewriteActivities(ctx context.Context, rewrite func(activity string) (string, bool), dryRun bool) ([]*constructs.UserData, error) {
+	if dryRun {
+		records, err := dd.List(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("List() returns err: %w", err)
+		}
+		return dao.ChangedActivities(records, rewrite), nil
+	}
+
+	lock, err := filelock.Exclusive(ctx, dd.path)
+	if err != nil {
+		return nil, fmt.Errorf("filelock.Exclusive() returns err: %w", err)
+	}
+	defer lock.Unlock()
+
+	header, err := dd.ensureFormat()
+	if apperror.IsNotFoundError(err) {
+		return []*constructs.UserData{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ensureFormat() returns err: %w", err)
+	}
+
+	column := indexOf(header, string(constructs.Activity))
+	if column < 0 {
+		return nil, fmt.Errorf("%s has no %s column", dd.path, constructs.Activity)
+	}
+	changed := []*constructs.UserData{}
+	err = dd.rewrite(func(rows [][]string) ([][]string, error) {
+		for idx, row := range rows[1:] {
+			if column >= len(row) {
+				continue
+			}
+			to, ok := rewrite(row[column])
+			if !ok || to == row[column] {
+				continue
+			}
+
+			record, err := parseRow(header, row)
 			if err != nil {
-				return fmt.Errorf("error creating file: %w", err)
+				return nil, fmt.Errorf("parseRow() of line %d returns err: %w", idx+2, err)
 			}
-		} else {
-			return fmt.Errorf("error opening file: %w", err)
+			changed = append(changed, record)
+			rows[idx+1][column] = to
+		}
+		return rows, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(changed, func(i, j int) bool { return changed[i].TimestampMS < changed[j].TimestampMS })
+	return changed, nil
+}
+
+func (dd *DataDAO) List(ctx context.Context, filter *constructs.UserDataFilter) ([]*constructs.UserData, error) {
+	it, err := dd.Iterate(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("Iterate() returns err: %w", err)
+	}
+	defer it.Close()
+
+	output := []*constructs.UserData{}
+	for it.Next() {
+		output = append(output, it.UserData())
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("iterating %s returns err: %w", dd.path, err)
+	}
+
+	sort.SliceStable(output, func(i, j int) bool { return output[i].TimestampMS < output[j].TimestampMS })
+
+	return output, nil
+}
+
+// Iterate holds a shared lock on the file until the iterator is closed. It
+// reads files in an older format as ensureFormat would upgrade them, but
+// leaves upgrading them to the next write.
+func (dd *DataDAO) Iterate(ctx context.Context, filter *constructs.UserDataFilter) (dao.UserDataIterator, error) {
+	lock, err := filelock.Shared(ctx, dd.path)
+	if err != nil {
+		return nil, fmt.Errorf("filelock.Shared() returns err: %w", err)
+	}
+
+	f, err := os.Open(dd.path)
+	if err != nil {
+		lock.Unlock()
+		if apperror.IsNotFoundError(err) {
+			// Nothing has been logged yet.
+			return &csvIterator{filter: filter}, nil
+		}
+		return nil, fmt.Errorf("os.Open(%s) returns err: %w", dd.path, err)
+	}
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+
+	return &csvIterator{
+		ctx:    ctx,
+		lock:   lock,
+		file:   f,
+		reader: reader,
+		filter: filter,
+	}, nil
+}
+
+// ensureFormat upgrades an existing file to carry a header and an ID column
+// and returns the header. Files written before headers existed are assumed
+// to hold legacyColumns. Callers hold an exclusive lock.
+func (dd *DataDAO) ensureFormat() ([]string, error) {
+	header, err := readHeader(dd.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if header != nil && indexOf(header, IDColumn) == 1 {
+		return header, nil
+	}
+
+	newHeader := upgradeHeader(header)
+	if err := dd.rewrite(func(rows [][]string) ([][]string, error) {
+		if header != nil {
+			rows = rows[1:]
+		}
+
+		output := [][]string{newHeader}
+		for idx, row := range rows {
+			output = append(output, upgradeRow(row, idx, header == nil))
 		}
+		return output, nil
+	}); err != nil {
+		return nil, fmt.Errorf("rewrite() migrating to header %v returns err: %w", newHeader, err)
+	}
+
+	return newHeader, nil
+}
+
+// upgradeHeader is the header ensureFormat gives a file with header, nil if
+// the file predates headers.
+func upgradeHeader(header []string) []string {
+	if header == nil {
+		return currentHeader()
+	}
+	return append([]string{TimestampColumn, IDColumn}, header[1:]...)
+}
+
+// upgradeRow is the idx-th row of a file without an ID column as
+// ensureFormat writes it, headerless if the file predates headers. The ID it
+// gets only depends on idx, so records read before the upgrade keep theirs.
+func upgradeRow(row []string, idx int, headerless bool) []string {
+	if headerless {
+		row = trimLegacyRow(row)
+	}
+	return append([]string{row[0], fmt.Sprintf("legacy-%d", idx+1)}, row[1:]...)
+}
+
+// ensureColumns extends header with any key of data it doesn't have yet.
+func (dd *DataDAO) ensureColumns(header []string, data *constructs.UserData) ([]string, error) {
+	unknownColumns := []string{}
+	for key := range data.Data {
+		if isReserved(key) {
+			return nil, fmt.Errorf("%q is not a valid column name", key)
+		}
+		if indexOf(header, key) < 0 {
+			unknownColumns = append(unknownColumns, key)
+		}
+	}
+
+	if data.StartMS != 0 || data.EndMS != 0 {
+		for _, column := range []string{StartColumn, EndColumn} {
+			if indexOf(header, column) < 0 {
+				unknownColumns = append(unknownColumns, column)
+			}
+		}
+	}
+
+	if len(unknownColumns) == 0 {
+		return header, nil
+	}
+
+	sort.Strings(unknownColumns)
+	newHeader := extendHeader(header, unknownColumns)
+	if err := dd.rewrite(func(rows [][]string) ([][]string, error) {
+		rows[0] = newHeader
+		return rows, nil
+	}); err != nil {
+		return nil, fmt.Errorf("rewrite() adding columns %v returns err: %w", unknownColumns, err)
+	}
+
+	return newHeader, nil
+}
+
+// rewrite replaces the whole file with the output of edit.
+func (dd *DataDAO) rewrite(edit func(rows [][]string) ([][]string, error)) error {
+	f, err := os.Open(dd.path)
+	if err != nil {
+		return fmt.Errorf("os.Open(%s) returns err: %w", dd.path, err)
+	}
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("csv.ReadAll() returns err: %w", err)
+	}
+
+	rows, err = edit(rows)
+	if err != nil {
+		return err
+	}
+
+	return writeRows(dd.path, rows)
+}
+
+// writeRows writes rows to path with atomicfile.Write.
+func writeRows(path string, rows [][]string) error {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("csv.WriteAll() returns err: %w", err)
+	}
+
+	return atomicfile.Write(path, buf.Bytes(), 0600)
+}
+
+// readHeader returns the header of the file at path, or nil if the file predates headers.
+func readHeader(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
 	defer f.Close()
 
-	keys := []string{}
-	for k := range data.Data {
-		keys = append(keys, k)
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	row, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
 	}
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
-	row := ""
-	for _, k := range keys {
-		row += fmt.Sprintf("%v,", data.Data[k])
+	if err != nil {
+		return nil, fmt.Errorf("csv.Read() returns err: %w", err)
 	}
 
-	if _, err = f.WriteString(fmt.Sprintf("%d,%s\n", data.TimestampMS, row)); err != nil {
-		return fmt.Errorf("error writing file: %w", err)
+	if !isHeader(row) {
+		return nil, nil
+	}
+
+	return row, nil
+}
+
+func currentHeader() []string {
+	return extendHeader([]string{TimestampColumn, IDColumn}, legacyColumns)
+}
+
+// isReserved reports whether key can't be a data key, because it's empty or
+// names a column that holds a UserData field.
+func isReserved(key string) bool {
+	switch key {
+	case "", TimestampColumn, IDColumn, StartColumn, EndColumn:
+		return true
+	default:
+		return false
+	}
+}
+
+func isHeader(row []string) bool {
+	return len(row) > 0 && row[0] == TimestampColumn
+}
+
+func extendHeader(header []string, columns []string) []string {
+	output := append([]string{}, header...)
+	for _, column := range columns {
+		if indexOf(output, column) < 0 {
+			output = append(output, column)
+		}
+	}
+	return output
+}
+
+func indexOf(columns []string, column string) int {
+	for idx, c := range columns {
+		if c == column {
+			return idx
+		}
+	}
+	return -1
+}
+
+func toRow(header []string, data *constructs.UserData) []string {
+	row := make([]string, len(header))
+	row[0] = strconv.FormatInt(data.TimestampMS, 10)
+	row[1] = data.ID
+	for idx, column := range header[2:] {
+		switch column {
+		case StartColumn:
+			row[idx+2] = formatMS(data.StartMS)
+		case EndColumn:
+			row[idx+2] = formatMS(data.EndMS)
+		default:
+			if val, ok := data.Data[column]; ok && val != nil {
+				row[idx+2] = fmt.Sprintf("%v", val)
+			}
+		}
 	}
+	return row
+}
+
+// formatMS leaves unset times empty.
+func formatMS(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return strconv.FormatInt(ms, 10)
+}
 
-	return nil
+// trimLegacyRow drops the trailing comma header-less rows were written with.
+func trimLegacyRow(row []string) []string {
+	if len(row) > len(legacyColumns)+1 && row[len(row)-1] == "" {
+		return row[:len(row)-1]
+	}
+	return row
+}
+
+type csvIterator struct {
+	ctx    context.Context
+	lock   *filelock.Lock
+	file   *os.File
+	reader *csv.Reader
+	filter *constructs.UserDataFilter
+
+	header []string
+	// upgrading is set for files without an ID column, whose rows are read
+	// as ensureFormat would upgrade them, and rows counts those read so far.
+	upgrading  bool
+	headerless bool
+	rows       int
+	line       int
+	current    *constructs.UserData
+	err        error
+}
+
+func (ci *csvIterator) Next() bool {
+	if ci.reader == nil || ci.err != nil {
+		return false
+	}
+
+	for {
+		if err := ci.ctx.Err(); err != nil {
+			ci.err = err
+			return false
+		}
+
+		row, err := ci.reader.Read()
+		ci.line++
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			ci.err = fmt.Errorf("csv.Read() returns err: %w", err)
+			return false
+		}
+
+		if ci.header == nil {
+			var header []string
+			if isHeader(row) {
+				header = row
+			}
+			if header != nil && indexOf(header, IDColumn) == 1 {
+				ci.header = header
+				continue
+			}
+
+			ci.upgrading = true
+			ci.headerless = header == nil
+			ci.header = upgradeHeader(header)
+			if header != nil {
+				continue
+			}
+		}
+
+		if ci.upgrading {
+			row = upgradeRow(row, ci.rows, ci.headerless)
+		}
+		ci.rows++
+
+		data, err := parseRow(ci.header, row)
+		if err != nil {
+			ci.err = fmt.Errorf("parseRow() at line %d returns err: %w", ci.line, err)
+			return false
+		}
+
+		if ci.filter.Matches(data) {
+			ci.current = data
+			return true
+		}
+	}
+}
+
+func (ci *csvIterator) UserData() *constructs.UserData {
+	return ci.current
+}
+
+func (ci *csvIterator) Err() error {
+	return ci.err
+}
+
+func (ci *csvIterator) Close() error {
+	if ci.file == nil {
+		return nil
+	}
+	defer ci.lock.Unlock()
+	return ci.file.Close()
+}
+
+func parseRow(header []string, row []string) (*constructs.UserData, error) {
+	if len(row) > len(header) {
+		return nil, fmt.Errorf("want at most %d columns, got %d: %v", len(header), len(row), row)
+	}
+
+	timestampMS, err := strconv.ParseInt(row[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("strconv.ParseInt(%q) returns err: %w", row[0], err)
+	}
+
+	if len(row) < 2 || row[1] == "" {
+		return nil, fmt.Errorf("row has no ID: %v", row)
+	}
+
+	userData := &constructs.UserData{
+		ID:          row[1],
+		Data:        map[string]interface{}{},
+		TimestampMS: timestampMS,
+	}
+	for idx, raw := range row[2:] {
+		// Rows written before a column was added leave it empty.
+		if raw == "" {
+			continue
+		}
+
+		column := header[idx+2]
+		switch column {
+		case StartColumn, EndColumn:
+			ms, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("strconv.ParseInt(%q) in %s returns err: %w", raw, column, err)
+			}
+			if column == StartColumn {
+				userData.StartMS = ms
+			} else {
+				userData.EndMS = ms
+			}
+			continue
+		}
+
+		val, err := parseValue(column, raw)
+		if err != nil {
+			return nil, fmt.Errorf("parseValue(%s, %q) returns err: %w", column, raw, err)
+		}
+		userData.Data[column] = val
+	}
+
+	return userData, nil
+}
+
+func parseValue(column string, raw string) (interface{}, error) {
+	switch constructs.UserDataKey(column) {
+	case constructs.MinutesSpent:
+		return strconv.Atoi(raw)
+	default:
+		return raw, nil
+	}
 }
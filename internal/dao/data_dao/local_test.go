@@ -0,0 +1,380 @@
+package datadao_test
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	datadao "activity_log/internal/dao/data_dao"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendAll(t *testing.T, dd *datadao.DataDAO, records []*constructs.UserData) {
+	t.Helper()
+	for _, record := range records {
+		if err := dd.Append(context.Background(), record); err != nil {
+			t.Fatalf("Append(%+v) returns err: %v", record, err)
+		}
+	}
+}
+
+func newRecord(activity string, minutes int, timestampMS int64) *constructs.UserData {
+	return &constructs.UserData{
+		Data: map[string]interface{}{
+			string(constructs.Activity):     activity,
+			string(constructs.MinutesSpent): minutes,
+		},
+		TimestampMS: timestampMS,
+	}
+}
+
+// readMaskingIDs returns the file at path with every record ID replaced by "*".
+func readMaskingIDs(t *testing.T, path string) string {
+	t.Helper()
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+
+	lines := strings.Split(string(bytes), "\n")
+	for idx, line := range lines[1:] {
+		fields := strings.SplitN(line, ",", 3)
+		if len(fields) == 3 {
+			fields[1] = "*"
+			lines[idx+1] = strings.Join(fields, ",")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestList(t *testing.T) {
+	dd := datadao.NewDataDAO(filepath.Join(t.TempDir(), "data.csv"))
+
+	coding := newRecord("working.coding", 10, 1000)
+	coding.SetTags([]string{"#ticket-123", "#pairing"})
+	coding.SetNote("Reviewed the parser, with commas")
+	codingX := newRecord("working.codingX", 30, 3000)
+	codingX.SetTags([]string{"#ticket-123"})
+
+	appendAll(t, dd, []*constructs.UserData{
+		coding,
+		newRecord("working.coding.debugging", 20, 2000),
+		codingX,
+		newRecord("SideProject", 40, 4000),
+	})
+
+	testCases := []struct {
+		desc        string
+		filter      *constructs.UserDataFilter
+		wantMinutes []int
+	}{
+		{
+			desc:        "nil filter",
+			filter:      nil,
+			wantMinutes: []int{10, 20, 30, 40},
+		},
+		{
+			desc:        "time range",
+			filter:      &constructs.UserDataFilter{SinceMS: 2000, UntilMS: 4000},
+			wantMinutes: []int{20, 30},
+		},
+		{
+			desc:        "activity prefix",
+			filter:      &constructs.UserDataFilter{ActivityPrefix: "working.coding"},
+			wantMinutes: []int{10, 20},
+		},
+		{
+			desc:        "time range and prefix",
+			filter:      &constructs.UserDataFilter{SinceMS: 1500, ActivityPrefix: "working"},
+			wantMinutes: []int{20, 30},
+		},
+		{
+			desc:        "tag",
+			filter:      &constructs.UserDataFilter{Tags: []string{"#Ticket-123"}},
+			wantMinutes: []int{10, 30},
+		},
+		{
+			desc:        "every tag",
+			filter:      &constructs.UserDataFilter{Tags: []string{"ticket-123", "pairing"}},
+			wantMinutes: []int{10},
+		},
+		{
+			desc:        "note",
+			filter:      &constructs.UserDataFilter{NoteContains: "parser, WITH"},
+			wantMinutes: []int{10},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := dd.List(context.Background(), tc.filter)
+			if err != nil {
+				t.Fatalf("List() returns err: %v", err)
+			}
+
+			if len(got) != len(tc.wantMinutes) {
+				t.Fatalf("List() returns %d records, want %d", len(got), len(tc.wantMinutes))
+			}
+
+			for idx, record := range got {
+				minutes, err := record.Minutes()
+				if err != nil {
+					t.Fatalf("Minutes() returns err: %v", err)
+				}
+				if minutes != tc.wantMinutes[idx] {
+					t.Errorf("record %d has %d minutes, want %d", idx, minutes, tc.wantMinutes[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestIterateMissingFile(t *testing.T) {
+	dd := datadao.NewDataDAO(filepath.Join(t.TempDir(), "data.csv"))
+
+	it, err := dd.Iterate(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Iterate() returns err: %v", err)
+	}
+	defer it.Close()
+
+	if it.Next() {
+		t.Fatalf("Next() returns true for a missing file")
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err() returns err: %v", err)
+	}
+}
+
+func TestAppendWritesHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	dd := datadao.NewDataDAO(path)
+
+	appendAll(t, dd, []*constructs.UserData{
+		newRecord("working.coding", 10, 1000),
+	})
+
+	got := readMaskingIDs(t, path)
+
+	want := "TIMESTAMP_MS,ID,ACTIVITY,MINUTES\n1000,*,working.coding,10\n"
+	if string(got) != want {
+		t.Errorf("file contents: got %q, want %q", got, want)
+	}
+}
+
+func TestAppendMigratesLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	legacy := "1636662408470,working.SideProject,360,\n1636726964215,working.MeetElise,8,\n"
+	if err := ioutil.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+	dd := datadao.NewDataDAO(path)
+
+	legacyRecords, err := dd.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() on legacy file returns err: %v", err)
+	}
+	if len(legacyRecords) != 2 || legacyRecords[0].ActivityPath() != "working.SideProject" {
+		t.Fatalf("List() on legacy file returns %+v", legacyRecords)
+	}
+
+	appendAll(t, dd, []*constructs.UserData{
+		newRecord("working.coding", 10, 1636726964216),
+	})
+
+	got := readMaskingIDs(t, path)
+
+	want := "TIMESTAMP_MS,ID,ACTIVITY,MINUTES\n" +
+		"1636662408470,*,working.SideProject,360\n" +
+		"1636726964215,*,working.MeetElise,8\n" +
+		"1636726964216,*,working.coding,10\n"
+	if string(got) != want {
+		t.Errorf("file contents: got %q, want %q", got, want)
+	}
+}
+
+func TestListLeavesLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	legacy := "1636662408470,working.SideProject,360,\n1636726964215,working.MeetElise,8,\n"
+	if err := ioutil.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+	dd := datadao.NewDataDAO(path)
+
+	records, err := dd.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	if string(bytes) != legacy {
+		t.Errorf("List() rewrites the file to %q, want it left as %q", bytes, legacy)
+	}
+
+	// Records keep the IDs they were read with once a write upgrades the file.
+	records[1].Data[string(constructs.MinutesSpent)] = 9
+	if err := dd.Update(context.Background(), records[1]); err != nil {
+		t.Fatalf("Update() of a record read before the upgrade returns err: %v", err)
+	}
+	again, err := dd.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	if again[0].ID != records[0].ID || again[1].ID != records[1].ID {
+		t.Errorf("List() after the upgrade returns IDs %s and %s, want %s and %s", again[0].ID, again[1].ID, records[0].ID, records[1].ID)
+	}
+	if minutes, _ := again[1].Minutes(); minutes != 9 {
+		t.Errorf("Update() after the upgrade leaves %d minutes, want 9", minutes)
+	}
+}
+
+func TestAppendExtendsColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	dd := datadao.NewDataDAO(path)
+
+	withNote := newRecord("working.coding", 20, 2000)
+	withNote.Data["NOTE"] = "pairing, with a comma"
+
+	appendAll(t, dd, []*constructs.UserData{
+		newRecord("working.coding", 10, 1000),
+		withNote,
+	})
+
+	got := readMaskingIDs(t, path)
+
+	want := "TIMESTAMP_MS,ID,ACTIVITY,MINUTES,NOTE\n" +
+		"1000,*,working.coding,10\n" +
+		"2000,*,working.coding,20,\"pairing, with a comma\"\n"
+	if string(got) != want {
+		t.Errorf("file contents: got %q, want %q", got, want)
+	}
+
+	records, err := dd.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	if _, ok := records[0].Data["NOTE"]; ok {
+		t.Errorf("first record should have no note: %+v", records[0])
+	}
+	if records[1].Data["NOTE"] != "pairing, with a comma" {
+		t.Errorf("second record note: got %v", records[1].Data["NOTE"])
+	}
+
+	if err := dd.Append(context.Background(), &constructs.UserData{Data: map[string]interface{}{datadao.TimestampColumn: 1}}); err == nil {
+		t.Errorf("Append() with a reserved column should return err")
+	}
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	dd := datadao.NewDataDAO(filepath.Join(t.TempDir(), "data.csv"))
+
+	first := newRecord("working.coding", 10, 1000)
+	second := newRecord("working.meeting", 20, 2000)
+	appendAll(t, dd, []*constructs.UserData{first, second})
+
+	if first.ID == "" || first.ID == second.ID {
+		t.Fatalf("Append() should assign unique IDs, got %q and %q", first.ID, second.ID)
+	}
+
+	first.Data[string(constructs.MinutesSpent)] = 15
+	if err := dd.Update(context.Background(), first); err != nil {
+		t.Fatalf("Update() returns err: %v", err)
+	}
+
+	if err := dd.Delete(context.Background(), second.ID); err != nil {
+		t.Fatalf("Delete() returns err: %v", err)
+	}
+
+	records, err := dd.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != first.ID {
+		t.Fatalf("List() after Delete() returns %+v", records)
+	}
+	if minutes, _ := records[0].Minutes(); minutes != 15 {
+		t.Errorf("Update() didn't persist minutes, got %d", minutes)
+	}
+
+	if err := dd.Delete(context.Background(), second.ID); !apperror.IsNotFoundError(err) {
+		t.Errorf("Delete() of a missing record returns %v, want a NotFoundError", err)
+	}
+	if err := dd.Update(context.Background(), second); !apperror.IsNotFoundError(err) {
+		t.Errorf("Update() of a missing record returns %v, want a NotFoundError", err)
+	}
+}
+
+func TestUpdateAndDeleteSkipShortRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	dd := datadao.NewDataDAO(path)
+
+	record := newRecord("working.coding", 10, 1000)
+	appendAll(t, dd, []*constructs.UserData{record})
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	if err := ioutil.WriteFile(path, append(bytes, []byte("1500\n")...), 0644); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+
+	if err := dd.Update(context.Background(), &constructs.UserData{ID: "missing", TimestampMS: 1}); !apperror.IsNotFoundError(err) {
+		t.Errorf("Update() past a short row returns %v, want a NotFoundError", err)
+	}
+	if err := dd.Delete(context.Background(), record.ID); err != nil {
+		t.Errorf("Delete() past a short row returns err: %v", err)
+	}
+}
+
+func TestRewriteActivitiesWithoutActivityColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := ioutil.WriteFile(path, []byte("TIMESTAMP_MS,ID,MINUTES\n1000,abc,10\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+
+	rewrite := func(activity string) (string, bool) { return "other", true }
+	if _, err := datadao.NewDataDAO(path).RewriteActivities(context.Background(), rewrite, false); err == nil {
+		t.Errorf("RewriteActivities() of a file without an activity column returns nil, want an error")
+	}
+}
+
+func TestAppendKeepsSpan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	dd := datadao.NewDataDAO(path)
+
+	backfilled := newRecord("working.meeting", 60, 0)
+	backfilled.SetSpan(time.Unix(0, 0).Add(10*time.Hour), time.Unix(0, 0).Add(11*time.Hour))
+
+	appendAll(t, dd, []*constructs.UserData{
+		newRecord("working.coding", 10, 1000),
+		backfilled,
+	})
+
+	got := readMaskingIDs(t, path)
+
+	want := "TIMESTAMP_MS,ID,ACTIVITY,MINUTES,END_MS,START_MS\n" +
+		"1000,*,working.coding,10\n" +
+		"39600000,*,working.meeting,60,39600000,36000000\n"
+	if string(got) != want {
+		t.Errorf("file contents: got %q, want %q", got, want)
+	}
+
+	records, err := dd.List(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+
+	// Records from before spans were kept end when they were logged and start minutes before.
+	if start := records[0].Start(); !start.Equal(time.Unix(0, 0).Add(time.Second - 10*time.Minute)) {
+		t.Errorf("first record starts at %v", start)
+	}
+	if records[1].StartMS != backfilled.StartMS || records[1].EndMS != backfilled.EndMS {
+		t.Errorf("List() returns span %d-%d, want %d-%d", records[1].StartMS, records[1].EndMS, backfilled.StartMS, backfilled.EndMS)
+	}
+}
@@ -1,9 +1,15 @@
 package schemadao
 
 import (
+	"activity_log/api/apperror"
 	"activity_log/api/constants"
 	"activity_log/api/constructs"
+	"activity_log/internal/atomicfile"
+	"activity_log/internal/filelock"
 	"activity_log/internal/util"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,28 +17,110 @@ import (
 )
 
 type LocalSchemaDAO struct {
-	path string
+	path    string
+	backups int
+
+	// loadedDigest is the sha256 of the file as of the last Load or Dump,
+	// nil if this DAO hasn't seen the file yet.
+	loadedDigest []byte
 }
 
-func NewLocalSchemaDAO(path string) *LocalSchemaDAO {
+// NewLocalSchemaDAO keeps the schema at path, and the {backups} versions
+// before the current one at path.1 (newest) through path.{backups}.
+func NewLocalSchemaDAO(path string, backups int) *LocalSchemaDAO {
 	return &LocalSchemaDAO{
-		path: path,
+		path:    path,
+		backups: backups,
 	}
 }
 
-func (lsd *LocalSchemaDAO) Load() (*constructs.UserSchema, error) {
-	us, err := loadUserSchema(lsd.path)
+func (lsd *LocalSchemaDAO) Load(ctx context.Context) (*constructs.UserSchema, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	jsonBytes, err := ioutil.ReadFile(lsd.path)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(%s) returns err: %w", lsd.path, err)
+	}
+
+	us, version, err := unmarshalUserSchema(jsonBytes)
 	if err != nil {
-		return nil, fmt.Errorf("loadUserSchema(%s) returns err: %w", lsd.path, err)
+		return nil, fmt.Errorf("UnmarshalUserSchema(%s) returns err: %w", lsd.path, err)
+	}
+
+	lsd.loadedDigest = digest(jsonBytes)
+
+	// Saving the upgraded schema keeps the old format as a backup. Another
+	// process saving first upgrades it just as well.
+	if version < schemaVersion {
+		if err := lsd.Dump(ctx, us, false); err != nil && !apperror.IsConflictError(err) {
+			return nil, fmt.Errorf("Dump() of the schema upgraded from version %d returns err: %w", version, err)
+		}
 	}
+
 	return us, nil
 }
 
-func (lsd *LocalSchemaDAO) Dump(schema *constructs.UserSchema, force bool) error {
-	return dumpUserSchema(lsd.path, schema)
+// Dump atomically replaces the schema file. Unless force is set, it refuses
+// with a ConflictError to overwrite a file that changed on disk since this
+// DAO last loaded or dumped it.
+func (lsd *LocalSchemaDAO) Dump(ctx context.Context, schema *constructs.UserSchema, force bool) error {
+	jsonBytes, err := MarshalUserSchema(schema)
+	if err != nil {
+		return fmt.Errorf("MarshalUserSchema() returns err: %w", err)
+	}
+
+	// Other processes dump between our check and our write otherwise.
+	lock, err := filelock.Exclusive(ctx, lsd.path)
+	if err != nil {
+		return fmt.Errorf("filelock.Exclusive() returns err: %w", err)
+	}
+	defer lock.Unlock()
+
+	current, err := ioutil.ReadFile(lsd.path)
+	if err != nil && !apperror.IsNotFoundError(err) {
+		return fmt.Errorf("ioutil.ReadFile(%s) returns err: %w", lsd.path, err)
+	}
+	exists := err == nil
+
+	if !force && exists && !bytes.Equal(digest(current), lsd.loadedDigest) {
+		return apperror.NewConflictError(fmt.Errorf("%s changed on disk since it was loaded", lsd.path))
+	}
+
+	if exists {
+		if err := lsd.rotateBackups(current); err != nil {
+			return fmt.Errorf("rotateBackups() returns err: %w", err)
+		}
+	}
+
+	if err := atomicfile.Write(lsd.path, jsonBytes, 0644); err != nil {
+		return fmt.Errorf("atomicfile.Write(%s) returns err: %w", lsd.path, err)
+	}
+
+	lsd.loadedDigest = digest(jsonBytes)
+
+	return nil
 }
 
-func (lsd *LocalSchemaDAO) Init() (*constructs.UserSchema, error) {
+// HasChanged reports whether the file differs from what this DAO last loaded or dumped.
+func (lsd *LocalSchemaDAO) HasChanged(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	current, err := ioutil.ReadFile(lsd.path)
+	if err != nil {
+		if apperror.IsNotFoundError(err) {
+			return lsd.loadedDigest != nil, nil
+		}
+		return false, fmt.Errorf("ioutil.ReadFile(%s) returns err: %w", lsd.path, err)
+	}
+
+	return !bytes.Equal(digest(current), lsd.loadedDigest), nil
+}
+
+func (lsd *LocalSchemaDAO) Init(ctx context.Context) (*constructs.UserSchema, error) {
 	defaultUserMap, err := util.NewExpandingMap(constants.DEFAULT_USER_SCHEMA)
 	if err != nil {
 		return nil, fmt.Errorf("NewExpandingMap returns err: %v", err)
@@ -42,44 +130,162 @@ func (lsd *LocalSchemaDAO) Init() (*constructs.UserSchema, error) {
 		Schema: defaultUserMap,
 	}
 
-	return defaultUserSchema, dumpUserSchema(lsd.path, defaultUserSchema)
+	return defaultUserSchema, lsd.Dump(ctx, defaultUserSchema, true)
 }
 
-func dumpUserSchema(path string, schema *constructs.UserSchema) error {
-	jsonBytes, err := json.Marshal(schema.Schema.ToRegularMap())
-	if err != nil {
-		return fmt.Errorf("json.Marshall(%+v) returns err: %w", schema, err)
+// rotateBackups shifts path.1 .. path.{backups-1} up by one and saves current as path.1.
+func (lsd *LocalSchemaDAO) rotateBackups(current []byte) error {
+	if lsd.backups <= 0 {
+		return nil
 	}
 
-	if err := os.WriteFile(path, jsonBytes, 0644); err != nil {
-		return fmt.Errorf("os.WriteFile() returns err: %w", err)
+	for idx := lsd.backups - 1; idx > 0; idx-- {
+		if err := os.Rename(lsd.backupPath(idx), lsd.backupPath(idx+1)); err != nil && !apperror.IsNotFoundError(err) {
+			return fmt.Errorf("os.Rename(%s) returns err: %w", lsd.backupPath(idx), err)
+		}
 	}
 
-	return nil
+	return atomicfile.Write(lsd.backupPath(1), current, 0644)
 }
 
-func loadUserSchema(path string) (*constructs.UserSchema, error) {
-	jsonFile, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("os.Open(%s) returns err: %w", path, err)
+func (lsd *LocalSchemaDAO) backupPath(idx int) string {
+	return fmt.Sprintf("%s.%d", lsd.path, idx)
+}
+
+// storedSchema is the format MarshalUserSchema writes.
+type storedSchema struct {
+	Version    int                    `json:"version"`
+	Activities map[string]*storedNode `json:"activities"`
+}
+
+// storedNode is an activity, what's kept about it and the activities under it.
+type storedNode struct {
+	Archived            bool                   `json:"archived,omitempty"`
+	Description         string                 `json:"description,omitempty"`
+	Color               string                 `json:"color,omitempty"`
+	Billable            bool                   `json:"billable,omitempty"`
+	Rate                float64                `json:"rate,omitempty"`
+	DailyTargetMinutes  int                    `json:"daily_target_minutes,omitempty"`
+	WeeklyTargetMinutes int                    `json:"weekly_target_minutes,omitempty"`
+	ExternalID          string                 `json:"external_id,omitempty"`
+	Children            map[string]*storedNode `json:"children,omitempty"`
+}
+
+func (node *storedNode) meta() util.NodeMeta {
+	return util.NodeMeta{
+		Archived:            node.Archived,
+		Description:         node.Description,
+		Color:               node.Color,
+		Billable:            node.Billable,
+		Rate:                node.Rate,
+		DailyTargetMinutes:  node.DailyTargetMinutes,
+		WeeklyTargetMinutes: node.WeeklyTargetMinutes,
+		ExternalID:          node.ExternalID,
+	}
+}
+
+func newStoredNode(meta util.NodeMeta) *storedNode {
+	return &storedNode{
+		Archived:            meta.Archived,
+		Description:         meta.Description,
+		Color:               meta.Color,
+		Billable:            meta.Billable,
+		Rate:                meta.Rate,
+		DailyTargetMinutes:  meta.DailyTargetMinutes,
+		WeeklyTargetMinutes: meta.WeeklyTargetMinutes,
+		ExternalID:          meta.ExternalID,
+	}
+}
+
+// MarshalUserSchema encodes schema the way it is stored on disk.
+func MarshalUserSchema(schema *constructs.UserSchema) ([]byte, error) {
+	stored := &storedSchema{
+		Version:    schemaVersion,
+		Activities: toStoredNodes(schema.Schema),
 	}
 
-	bytes, err := ioutil.ReadAll(jsonFile)
+	jsonBytes, err := json.Marshal(stored)
 	if err != nil {
-		return nil, fmt.Errorf("ioutil.ReadAll() returns err: %w", err)
+		return nil, fmt.Errorf("json.Marshall(%+v) returns err: %w", schema, err)
 	}
+	return jsonBytes, nil
+}
+
+func toStoredNodes(em *util.ExpandingMap) map[string]*storedNode {
+	nodes := map[string]*storedNode{}
+	for _, key := range em.Keys() {
+		subMap, _ := em.GetSubMap([]string{key})
+		node := newStoredNode(subMap.Meta())
+		if !subMap.IsEmpty() {
+			node.Children = toStoredNodes(subMap)
+		}
+		nodes[key] = node
+	}
+	return nodes
+}
 
-	var schema map[string]interface{}
-	if err := json.Unmarshal(bytes, &schema); err != nil {
-		return nil, fmt.Errorf("json.Unmarshal returns err: %w", err)
+// UnmarshalUserSchema decodes bytes written by MarshalUserSchema, or in any
+// format before it.
+func UnmarshalUserSchema(bytes []byte) (*constructs.UserSchema, error) {
+	us, _, err := unmarshalUserSchema(bytes)
+	return us, err
+}
+
+// unmarshalUserSchema also returns the version bytes were written in.
+func unmarshalUserSchema(bytes []byte) (*constructs.UserSchema, int, error) {
+	stored, version, err := migrate(bytes)
+	if err != nil {
+		return nil, 0, fmt.Errorf("migrate() returns err: %w", err)
 	}
 
+	schema, metas := fromStoredNodes(stored.Activities, nil)
 	expandingSchema, err := util.NewExpandingMap(schema)
 	if err != nil {
-		return nil, fmt.Errorf("util.NewExpandingMap(%+v) returns err: %w", schema, err)
+		return nil, 0, fmt.Errorf("util.NewExpandingMap(%+v) returns err: %w", schema, err)
+	}
+	for _, pm := range metas {
+		if err := expandingSchema.SetMeta(pm.path, pm.meta); err != nil {
+			return nil, 0, fmt.Errorf("SetMeta(%v) returns err: %w", pm.path, err)
+		}
 	}
 
 	return &constructs.UserSchema{
 		Schema: expandingSchema,
-	}, nil
+	}, version, nil
+}
+
+// pathMeta is what's kept about the activity at path.
+type pathMeta struct {
+	path []string
+	meta util.NodeMeta
+}
+
+// fromStoredNodes returns nodes as the nested map NewExpandingMap takes, and
+// what's kept about those that have anything kept, each under parent.
+func fromStoredNodes(nodes map[string]*storedNode, parent []string) (map[string]interface{}, []pathMeta) {
+	schema := map[string]interface{}{}
+	metas := []pathMeta{}
+	for key, node := range nodes {
+		path := append(append([]string{}, parent...), key)
+		if node == nil {
+			schema[key] = nil
+			continue
+		}
+		if meta := node.meta(); meta != (util.NodeMeta{}) {
+			metas = append(metas, pathMeta{path: path, meta: meta})
+		}
+		if len(node.Children) == 0 {
+			schema[key] = nil
+			continue
+		}
+		children, childMetas := fromStoredNodes(node.Children, path)
+		schema[key] = children
+		metas = append(metas, childMetas...)
+	}
+	return schema, metas
+}
+
+func digest(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
 }
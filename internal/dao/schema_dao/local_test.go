@@ -0,0 +1,237 @@
+package schemadao_test
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	schemadao "activity_log/internal/dao/schema_dao"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newSchema(t *testing.T, input map[string]interface{}) *constructs.UserSchema {
+	t.Helper()
+	expandingMap, err := util.NewExpandingMap(input)
+	if err != nil {
+		t.Fatalf("NewExpandingMap() returns err: %v", err)
+	}
+	return &constructs.UserSchema{Schema: expandingMap}
+}
+
+func TestDumpKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	lsd := schemadao.NewLocalSchemaDAO(path, 2)
+
+	for _, option := range []string{"first", "second", "third", "fourth"} {
+		if err := lsd.Dump(context.Background(), newSchema(t, map[string]interface{}{option: nil}), false); err != nil {
+			t.Fatalf("Dump(%s) returns err: %v", option, err)
+		}
+	}
+
+	for path, want := range map[string]string{
+		path:        `{"version":3,"activities":{"fourth":{}}}`,
+		path + ".1": `{"version":3,"activities":{"third":{}}}`,
+		path + ".2": `{"version":3,"activities":{"second":{}}}`,
+	} {
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) returns err: %v", path, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+
+	if _, err := ioutil.ReadFile(path + ".3"); !apperror.IsNotFoundError(err) {
+		t.Errorf("only 2 backups should be kept, reading a third returns %v", err)
+	}
+}
+
+func TestDumpConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	mine := schemadao.NewLocalSchemaDAO(path, 0)
+	theirs := schemadao.NewLocalSchemaDAO(path, 0)
+
+	if _, err := mine.Init(context.Background()); err != nil {
+		t.Fatalf("Init() returns err: %v", err)
+	}
+
+	if _, err := theirs.Load(context.Background()); err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+	if err := theirs.Dump(context.Background(), newSchema(t, map[string]interface{}{"default": nil, "theirs": nil}), false); err != nil {
+		t.Fatalf("Dump() returns err: %v", err)
+	}
+
+	err := mine.Dump(context.Background(), newSchema(t, map[string]interface{}{"default": nil, "mine": nil}), false)
+	if !apperror.IsConflictError(err) {
+		t.Fatalf("Dump() over a schema changed on disk returns %v, want a ConflictError", err)
+	}
+
+	if err := mine.Dump(context.Background(), newSchema(t, map[string]interface{}{"default": nil, "mine": nil}), true); err != nil {
+		t.Fatalf("forced Dump() returns err: %v", err)
+	}
+
+	us, err := theirs.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+	if err := newSchema(t, map[string]interface{}{"default": nil, "mine": nil}).Schema.IsEqual(us.Schema); err != nil {
+		t.Errorf("forced Dump() didn't overwrite: %v", err)
+	}
+}
+
+func TestConcurrentLoadModifyDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if _, err := schemadao.NewLocalSchemaDAO(path, 1).Init(context.Background()); err != nil {
+		t.Fatalf("Init() returns err: %v", err)
+	}
+
+	const writers = 4
+	const optionsPerWriter = 10
+
+	errs := make(chan error, writers)
+	for writer := 0; writer < writers; writer++ {
+		go func(writer int) {
+			// A DAO per writer, like separate processes would have.
+			lsd := schemadao.NewLocalSchemaDAO(path, 1)
+			for option := 0; option < optionsPerWriter; option++ {
+				for {
+					us, err := lsd.Load(context.Background())
+					if err != nil {
+						errs <- err
+						return
+					}
+
+					if err := us.Schema.AddSubMap([]string{}, fmt.Sprintf("writer%d_option%d", writer, option)); err != nil {
+						errs <- err
+						return
+					}
+
+					err = lsd.Dump(context.Background(), us, false)
+					if err == nil {
+						break
+					}
+					if !apperror.IsConflictError(err) {
+						errs <- err
+						return
+					}
+				}
+			}
+			errs <- nil
+		}(writer)
+	}
+
+	for writer := 0; writer < writers; writer++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("writer returns err: %v", err)
+		}
+	}
+
+	us, err := schemadao.NewLocalSchemaDAO(path, 1).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+
+	if got := len(us.Schema.ToRegularMap()); got != 1+writers*optionsPerWriter {
+		t.Errorf("schema has %d options, want %d: some additions were lost", got, 1+writers*optionsPerWriter)
+	}
+}
+
+func TestUnmarshalUserSchema(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		input        string
+		wantSchema   map[string]interface{}
+		wantArchived [][]string
+		// wantMeta is what's kept about the activities it names, by dotted path.
+		wantMeta map[string]util.NodeMeta
+	}{
+		{
+			desc:         "version 1",
+			input:        `{"default":null,"working":{"coding":null,"meeting":null}}`,
+			wantSchema:   map[string]interface{}{"default": nil, "working": map[string]interface{}{"coding": nil, "meeting": nil}},
+			wantArchived: [][]string{},
+		},
+		{
+			desc:         "version 1 with an activity named version",
+			input:        `{"version":{"two":null}}`,
+			wantSchema:   map[string]interface{}{"version": map[string]interface{}{"two": nil}},
+			wantArchived: [][]string{},
+		},
+		{
+			desc:         "version 2 with archived activities",
+			input:        `{"version":2,"activities":{"default":{},"working":{"children":{"coding":{},"meeting":{"archived":true}}}}}`,
+			wantSchema:   map[string]interface{}{"default": nil, "working": map[string]interface{}{"coding": nil, "meeting": nil}},
+			wantArchived: [][]string{{"working", "meeting"}},
+		},
+		{
+			desc: "version 3 with metadata",
+			input: `{"version":3,"activities":{"default":{},"working":{"description":"the day job","color":"blue","billable":true,"rate":120.5,` +
+				`"daily_target_minutes":360,"weekly_target_minutes":1800,"external_id":"ACME-1","children":{"coding":{},"meeting":{}}}}}`,
+			wantSchema:   map[string]interface{}{"default": nil, "working": map[string]interface{}{"coding": nil, "meeting": nil}},
+			wantArchived: [][]string{},
+			wantMeta: map[string]util.NodeMeta{
+				"working": {
+					Description:         "the day job",
+					Color:               "blue",
+					Billable:            true,
+					Rate:                120.5,
+					DailyTargetMinutes:  360,
+					WeeklyTargetMinutes: 1800,
+					ExternalID:          "ACME-1",
+				},
+				"working.coding": {},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			us, err := schemadao.UnmarshalUserSchema([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("UnmarshalUserSchema() returns err: %v", err)
+			}
+			if err := util.NestedMapsEqual(tc.wantSchema, us.Schema.ToRegularMap()); err != nil {
+				t.Errorf("UnmarshalUserSchema() returns %+v, want %+v", us.Schema.ToRegularMap(), tc.wantSchema)
+			}
+			if got := us.Schema.ArchivedPaths(); !reflect.DeepEqual(got, tc.wantArchived) {
+				t.Errorf("UnmarshalUserSchema() archives %v, want %v", got, tc.wantArchived)
+			}
+			for activity, want := range tc.wantMeta {
+				subMap, err := us.Schema.GetSubMap(strings.Split(activity, "."))
+				if err != nil {
+					t.Fatalf("GetSubMap(%s) returns err: %v", activity, err)
+				}
+				if got := subMap.Meta(); got != want {
+					t.Errorf("UnmarshalUserSchema() keeps %+v about %s, want %+v", got, activity, want)
+				}
+			}
+
+			// What's written back reads the same.
+			jsonBytes, err := schemadao.MarshalUserSchema(us)
+			if err != nil {
+				t.Fatalf("MarshalUserSchema() returns err: %v", err)
+			}
+			again, err := schemadao.UnmarshalUserSchema(jsonBytes)
+			if err != nil {
+				t.Fatalf("UnmarshalUserSchema(%s) returns err: %v", jsonBytes, err)
+			}
+			if err := us.Schema.IsEqual(again.Schema); err != nil {
+				t.Errorf("MarshalUserSchema() writes %s, which reads differently: %v", jsonBytes, err)
+			}
+		})
+	}
+
+	if _, err := schemadao.UnmarshalUserSchema([]byte(`{"version":2,"activities":{"working":{"color":"mauve"}}}`)); err == nil {
+		t.Errorf("UnmarshalUserSchema() of an unknown color returns no err, want one")
+	}
+	if _, err := schemadao.UnmarshalUserSchema([]byte(`{"version":4,"activities":{}}`)); err == nil {
+		t.Errorf("UnmarshalUserSchema() of a newer version returns no err, want one")
+	}
+}
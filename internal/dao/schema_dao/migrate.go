@@ -0,0 +1,152 @@
+package schemadao
+
+import (
+	"activity_log/api/constants"
+	"encoding/json"
+	"fmt"
+)
+
+// schemaVersion is the version of the format MarshalUserSchema writes.
+const schemaVersion = 3
+
+// migrations upgrade a schema, decoded from JSON, from the version each is
+// keyed by to the one after it.
+var migrations = map[int]func(doc map[string]interface{}) (map[string]interface{}, error){
+	0: unwrapOptions,
+	1: nestActivities,
+	2: addMetadata,
+}
+
+// versionOf tells which version doc was written in. Those before 2 say
+// nothing of it: version 0, the prototype's, has the activities under
+// "options", and version 1 has them at the top.
+func versionOf(doc map[string]interface{}) (int, error) {
+	if raw, ok := doc["version"]; ok {
+		// Version 1 may have an activity named version, but not a number.
+		if number, ok := raw.(float64); ok {
+			if number != float64(int(number)) || number < 0 {
+				return 0, fmt.Errorf("%v isn't a schema version", number)
+			}
+			return int(number), nil
+		}
+	}
+
+	if _, ok := doc["options"].(map[string]interface{}); ok && len(doc) == 1 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// migrate decodes bytes, written in any version up to schemaVersion, in the
+// format of schemaVersion, and returns the version they were written in.
+func migrate(bytes []byte) (*storedSchema, int, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(bytes, &doc); err != nil {
+		return nil, 0, fmt.Errorf("json.Unmarshal returns err: %w", err)
+	}
+
+	version, err := versionOf(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > schemaVersion {
+		return nil, 0, fmt.Errorf("schema version %d is newer than this activity_log reads (%d), upgrade it", version, schemaVersion)
+	}
+
+	stored := &storedSchema{}
+	if version == schemaVersion {
+		if err := json.Unmarshal(bytes, stored); err != nil {
+			return nil, 0, fmt.Errorf("json.Unmarshal returns err: %w", err)
+		}
+		return stored, version, nil
+	}
+
+	for from := version; from < schemaVersion; from++ {
+		if doc, err = migrations[from](doc); err != nil {
+			return nil, 0, fmt.Errorf("upgrading from version %d returns err: %w", from, err)
+		}
+	}
+
+	jsonBytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil, 0, fmt.Errorf("json.Marshal returns err: %w", err)
+	}
+	if err := json.Unmarshal(jsonBytes, stored); err != nil {
+		return nil, 0, fmt.Errorf("json.Unmarshal returns err: %w", err)
+	}
+	return stored, version, nil
+}
+
+// unwrapOptions upgrades version 0 to 1. Version 0 counted records at the
+// leaves, where version 1 has null, and didn't always have the default
+// first option.
+func unwrapOptions(doc map[string]interface{}) (map[string]interface{}, error) {
+	options, _ := doc["options"].(map[string]interface{})
+
+	activities := clearLeaves(options)
+	if _, ok := activities[constants.DEFAULT_FIRST_OPTION]; !ok {
+		activities[constants.DEFAULT_FIRST_OPTION] = nil
+	}
+	return activities, nil
+}
+
+func clearLeaves(tree map[string]interface{}) map[string]interface{} {
+	cleared := map[string]interface{}{}
+	for key, val := range tree {
+		if subTree, ok := val.(map[string]interface{}); ok && len(subTree) > 0 {
+			cleared[key] = clearLeaves(subTree)
+			continue
+		}
+		cleared[key] = nil
+	}
+	return cleared
+}
+
+// nestActivities upgrades version 1 to 2, which keeps each activity in an
+// object of its own, to have room for what's kept about it.
+func nestActivities(doc map[string]interface{}) (map[string]interface{}, error) {
+	activities, err := toNodes(doc)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"version":    2,
+		"activities": activities,
+	}, nil
+}
+
+func toNodes(tree map[string]interface{}) (map[string]interface{}, error) {
+	nodes := map[string]interface{}{}
+	for key, val := range tree {
+		if val == nil {
+			nodes[key] = map[string]interface{}{}
+			continue
+		}
+
+		subTree, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%q is %T, not null or the activities under it", key, val)
+		}
+		children, err := toNodes(subTree)
+		if err != nil {
+			return nil, err
+		}
+		node := map[string]interface{}{}
+		if len(children) > 0 {
+			node["children"] = children
+		}
+		nodes[key] = node
+	}
+	return nodes, nil
+}
+
+// addMetadata upgrades version 2 to 3. Version 3 keeps more about each
+// activity than whether it's archived, all of which version 2 goes without.
+func addMetadata(doc map[string]interface{}) (map[string]interface{}, error) {
+	upgraded := map[string]interface{}{}
+	for key, val := range doc {
+		upgraded[key] = val
+	}
+	upgraded["version"] = 3
+	return upgraded, nil
+}
@@ -0,0 +1,104 @@
+package schemadao_test
+
+import (
+	schemadao "activity_log/internal/dao/schema_dao"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from what's read now")
+
+// TestMigrations reads a schema in each format there has been, from
+// testdata/migrations/*.json, and checks it's written back in the current one
+// as the .golden file next to it has it.
+func TestMigrations(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "migrations", "*.json"))
+	if err != nil {
+		t.Fatalf("Glob() returns err: %v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no schemas in testdata/migrations")
+	}
+
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			jsonBytes, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatalf("ReadFile(%s) returns err: %v", input, err)
+			}
+
+			us, err := schemadao.UnmarshalUserSchema(jsonBytes)
+			if err != nil {
+				t.Fatalf("UnmarshalUserSchema() returns err: %v", err)
+			}
+			got, err := schemadao.MarshalUserSchema(us)
+			if err != nil {
+				t.Fatalf("MarshalUserSchema() returns err: %v", err)
+			}
+			indented := &bytes.Buffer{}
+			if err := json.Indent(indented, got, "", "  "); err != nil {
+				t.Fatalf("json.Indent() returns err: %v", err)
+			}
+			indented.WriteString("\n")
+
+			golden := strings.TrimSuffix(input, ".json") + ".golden"
+			if *update {
+				if err := ioutil.WriteFile(golden, indented.Bytes(), 0644); err != nil {
+					t.Fatalf("WriteFile(%s) returns err: %v", golden, err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("ReadFile(%s) returns err: %v", golden, err)
+			}
+			if !bytes.Equal(indented.Bytes(), want) {
+				t.Errorf("%s is written back as\n%s\nwant\n%s", input, indented, want)
+			}
+		})
+	}
+}
+
+func TestLoadUpgrades(t *testing.T) {
+	old, err := ioutil.ReadFile(filepath.Join("testdata", "migrations", "v0_sample.json"))
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := ioutil.WriteFile(path, old, 0644); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+
+	lsd := schemadao.NewLocalSchemaDAO(path, 1)
+	us, err := lsd.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+
+	upgraded, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) returns err: %v", path, err)
+	}
+	if want, _ := schemadao.MarshalUserSchema(us); !bytes.Equal(upgraded, want) {
+		t.Errorf("Load() leaves %s, want it upgraded to %s", upgraded, want)
+	}
+	if backup, err := ioutil.ReadFile(path + ".1"); err != nil || !bytes.Equal(backup, old) {
+		t.Errorf("Load() leaves the backup %s (err: %v), want the schema as it was", backup, err)
+	}
+
+	// Loading again leaves the upgraded schema, and its backup, alone.
+	if _, err := lsd.Load(context.Background()); err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+	if changed, err := lsd.HasChanged(context.Background()); err != nil || changed {
+		t.Errorf("HasChanged() after loading twice returns %v, %v, want false", changed, err)
+	}
+	if backup, _ := ioutil.ReadFile(path + ".1"); !bytes.Equal(backup, old) {
+		t.Errorf("Load() of an upgraded schema rotates the backups")
+	}
+}
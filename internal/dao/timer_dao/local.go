@@ -0,0 +1,82 @@
+package timerdao
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	"activity_log/internal/atomicfile"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// LocalTimerDAO keeps the running timer in a JSON file, which only exists
+// while a timer runs.
+type LocalTimerDAO struct {
+	path string
+}
+
+func NewLocalTimerDAO(path string) *LocalTimerDAO {
+	return &LocalTimerDAO{
+		path: path,
+	}
+}
+
+type storedTimer struct {
+	Activity string `json:"activity"`
+	StartMS  int64  `json:"start_ms"`
+}
+
+func (ltd *LocalTimerDAO) LoadTimer(ctx context.Context) (*constructs.Timer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	jsonBytes, err := ioutil.ReadFile(ltd.path)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(%s) returns err: %w", ltd.path, err)
+	}
+
+	stored := &storedTimer{}
+	if err := json.Unmarshal(jsonBytes, stored); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal(%s) returns err: %w", ltd.path, err)
+	}
+
+	return &constructs.Timer{
+		Activity: stored.Activity,
+		StartMS:  stored.StartMS,
+	}, nil
+}
+
+func (ltd *LocalTimerDAO) SaveTimer(ctx context.Context, timer *constructs.Timer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.MarshalIndent(&storedTimer{
+		Activity: timer.Activity,
+		StartMS:  timer.StartMS,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent(%+v) returns err: %w", timer, err)
+	}
+
+	if err := atomicfile.Write(ltd.path, append(jsonBytes, '\n'), 0600); err != nil {
+		return fmt.Errorf("atomicfile.Write(%s) returns err: %w", ltd.path, err)
+	}
+
+	return nil
+}
+
+func (ltd *LocalTimerDAO) ClearTimer(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(ltd.path); err != nil && !apperror.IsNotFoundError(err) {
+		return fmt.Errorf("os.Remove(%s) returns err: %w", ltd.path, err)
+	}
+
+	return nil
+}
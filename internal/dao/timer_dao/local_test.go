@@ -0,0 +1,44 @@
+package timerdao_test
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	timerdao "activity_log/internal/dao/timer_dao"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestTimerRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "timer.json")
+	ltd := timerdao.NewLocalTimerDAO(path)
+
+	if _, err := ltd.LoadTimer(ctx); !apperror.IsNotFoundError(err) {
+		t.Fatalf("LoadTimer() before any timer returns %v, want a NotFoundError", err)
+	}
+
+	want := &constructs.Timer{Activity: "working.coding", StartMS: 1000}
+	if err := ltd.SaveTimer(ctx, want); err != nil {
+		t.Fatalf("SaveTimer() returns err: %v", err)
+	}
+
+	// A restart reads the timer back through a fresh DAO.
+	got, err := timerdao.NewLocalTimerDAO(path).LoadTimer(ctx)
+	if err != nil {
+		t.Fatalf("LoadTimer() returns err: %v", err)
+	}
+	if *got != *want {
+		t.Errorf("LoadTimer() returns %+v, want %+v", got, want)
+	}
+
+	if err := ltd.ClearTimer(ctx); err != nil {
+		t.Fatalf("ClearTimer() returns err: %v", err)
+	}
+	if _, err := ltd.LoadTimer(ctx); !apperror.IsNotFoundError(err) {
+		t.Errorf("LoadTimer() after ClearTimer() returns %v, want a NotFoundError", err)
+	}
+	if err := ltd.ClearTimer(ctx); err != nil {
+		t.Errorf("ClearTimer() with no timer returns err: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Package filelock provides advisory locks shared between activity_log processes.
+package filelock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// pollInterval is how long to wait between attempts on a lock another process holds.
+const pollInterval = 10 * time.Millisecond
+
+// Lock is held on a sidecar file, path + ".lock", so that the locked file
+// itself can be replaced by rename while the lock is held.
+type Lock struct {
+	file *os.File
+}
+
+// Exclusive waits until no other process holds any lock on path, or ctx is done.
+func Exclusive(ctx context.Context, path string) (*Lock, error) {
+	return lock(ctx, path, true)
+}
+
+// Shared waits until no other process holds an exclusive lock on path, or ctx is done.
+func Shared(ctx context.Context, path string) (*Lock, error) {
+	return lock(ctx, path, false)
+}
+
+func lock(ctx context.Context, path string, exclusive bool) (*Lock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(%s.lock) returns err: %w", path, err)
+	}
+
+	for {
+		locked, err := tryLockFile(f, exclusive)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("tryLockFile(%s) returns err: %w", f.Name(), err)
+		}
+		if locked {
+			return &Lock{file: f}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (l *Lock) Unlock() error {
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return fmt.Errorf("unlockFile(%s) returns err: %w", l.file.Name(), err)
+	}
+	return l.file.Close()
+}
@@ -1,10 +1,382 @@
+// Package initializer walks the user through setting activity_log up, and
+// through repairing whatever part of an install stopped working.
 package initializer
 
-import "fmt"
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constants"
+	"activity_log/api/constructs"
+	"activity_log/internal/config"
+	"activity_log/internal/dao"
+	"activity_log/internal/dao/backend"
+	schemadao "activity_log/internal/dao/schema_dao"
+	"activity_log/internal/notifier"
+	"activity_log/internal/reminder"
+	"activity_log/internal/user_input"
+	"activity_log/internal/user_output"
+	"context"
+	"embed"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultSchedule is suggested to users who have never picked one.
+const defaultSchedule = "every 30 minutes"
+
+//go:embed starters/*.json
+var starterFiles embed.FS
+
+// starter is a schema to begin with, kept in starters/{name}.json.
+type starter struct {
+	name        string
+	description string
+}
+
+var starters = []*starter{
+	{name: "work", description: "coding, meetings, reviewing and breaks"},
+	{name: "life", description: "working, exercise, chores, reading and resting"},
+	{name: "blank", description: "nothing yet, add options as you go"},
+}
 
 type Initializer struct {
+	userListener  *user_input.UserListener
+	userMessenger *user_output.UserMessenger
+	config        *config.Config
+}
+
+func New(userListener *user_input.UserListener, userMessenger *user_output.UserMessenger, cfg *config.Config) *Initializer {
+	return &Initializer{
+		userListener:  userListener,
+		userMessenger: userMessenger,
+		config:        cfg,
+	}
+}
+
+// IsFirstRun reports whether nothing has been set up yet: there's no config
+// file, and no schema where cfg expects the default profile's.
+func IsFirstRun(cfg *config.Config) bool {
+	if _, err := os.Stat(cfg.ConfigPath); err == nil {
+		return false
+	}
+
+	defaultCfg, err := cfg.ForProfile(constants.DEFAULT_PROFILE)
+	if err != nil {
+		return false
+	}
+	store := defaultCfg.SchemaPath
+	if defaultCfg.Backend == "bolt" {
+		store = defaultCfg.DBPath
+	}
+	_, err = os.Stat(store)
+	return apperror.IsNotFoundError(err)
+}
+
+// Init asks how to set activity_log up and does it, then saves the answers
+// to the config file. Run again, it offers what's already set up as the
+// default answers, keeps the schema and data that work and offers to fix
+// those that don't.
+func (in *Initializer) Init(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go in.userListener.Serve(ctx)
+
+	if err := in.userMessenger.Send("Setting up activity_log. Enter keeps the answer in brackets."); err != nil {
+		return fmt.Errorf("userMessenger.Send() returns err: %w", err)
+	}
+
+	backendName, err := in.choose(ctx, "Keep your activity in plain csv files you can open in a spreadsheet, or in a bolt database file?", []string{"csv", "bolt"}, in.config.Backend)
+	if err != nil {
+		return err
+	}
+	in.config.Backend = backendName
+
+	userInput, err := in.ask(ctx, fmt.Sprintf("Which directory should it go in? [%s]", in.config.Dir), func(*constructs.UserInput) error { return nil })
+	if err != nil {
+		return err
+	}
+	if userInput.Text != "" {
+		in.config.SetDir(userInput.Text, "init")
+	}
+
+	if err := in.config.MakeDirs(); err != nil {
+		return fmt.Errorf("MakeDirs() returns err: %w", err)
+	}
+
+	daos, err := backend.Open(in.config)
+	if err != nil {
+		return fmt.Errorf("backend.Open() returns err: %w", err)
+	}
+
+	if err := in.checkSchema(ctx, daos.Schema); err != nil {
+		return fmt.Errorf("checkSchema() returns err: %w", err)
+	}
+
+	if err := in.checkData(ctx, daos.Data); err != nil {
+		return fmt.Errorf("checkData() returns err: %w", err)
+	}
+
+	if err := in.setUpReminders(ctx); err != nil {
+		return fmt.Errorf("setUpReminders() returns err: %w", err)
+	}
+
+	if err := in.setUpNotifier(ctx); err != nil {
+		return fmt.Errorf("setUpNotifier() returns err: %w", err)
+	}
+
+	return in.saveConfig()
+}
+
+// InitSchema has the user pick a starter schema and saves it over whatever
+// schemaDAO holds.
+func (in *Initializer) InitSchema(ctx context.Context, schemaDAO dao.UserSchemaDAO) (*constructs.UserSchema, error) {
+	question := ""
+	for idx, s := range starters {
+		question += fmt.Sprintf("%d .) %s -- %s\n", idx, s.name, s.description)
+	}
+	question += "\nWhich schema would you like to start with? You can add options as you go. [0]"
+
+	userInput, err := in.ask(ctx, question, func(ui *constructs.UserInput) error {
+		if ui.Text == "" {
+			return nil
+		}
+		if digit, err := strconv.Atoi(ui.Text); err != nil || digit < 0 || digit >= len(starters) {
+			return fmt.Errorf("input not in range [%d, %d]", 0, len(starters)-1)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	choice, _ := strconv.Atoi(userInput.Text)
+
+	us, err := loadStarter(starters[choice].name)
+	if err != nil {
+		return nil, fmt.Errorf("loadStarter(%s) returns err: %w", starters[choice].name, err)
+	}
+
+	if err := schemaDAO.Dump(ctx, us, true); err != nil {
+		return nil, fmt.Errorf("schemaDAO.Dump() returns err: %w", err)
+	}
+
+	return us, nil
+}
+
+func loadStarter(name string) (*constructs.UserSchema, error) {
+	jsonBytes, err := starterFiles.ReadFile(fmt.Sprintf("starters/%s.json", name))
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile(%s) returns err: %w", name, err)
+	}
+	return schemadao.UnmarshalUserSchema(jsonBytes)
+}
+
+// checkSchema keeps a schema that loads, starts one if there is none, and
+// offers to restore a backup of one that's broken.
+func (in *Initializer) checkSchema(ctx context.Context, schemaDAO dao.UserSchemaDAO) error {
+	_, err := schemaDAO.Load(ctx)
+	if err == nil {
+		return in.userMessenger.Send("Your schema is fine, keeping it.")
+	}
+
+	if !apperror.IsNotFoundError(err) {
+		if err := in.userMessenger.Send(fmt.Sprintf("Your schema can't be read: %v", err)); err != nil {
+			return fmt.Errorf("userMessenger.Send() returns err: %w", err)
+		}
+
+		if restored, err := in.restoreBackup(ctx, schemaDAO); restored || err != nil {
+			return err
+		}
+	}
+
+	_, err = in.InitSchema(ctx, schemaDAO)
+	return err
+}
+
+// restoreBackup offers the newest backup of the schema file that still
+// loads, and reports whether the user took it.
+func (in *Initializer) restoreBackup(ctx context.Context, schemaDAO dao.UserSchemaDAO) (bool, error) {
+	if in.config.Backend != "csv" {
+		return false, nil
+	}
+
+	for idx := 1; idx <= constants.DEFAULT_SCHEMA_BACKUPS; idx++ {
+		path := fmt.Sprintf("%s.%d", in.config.SchemaPath, idx)
+		jsonBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		us, err := schemadao.UnmarshalUserSchema(jsonBytes)
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		ok, err := in.confirm(ctx, fmt.Sprintf("Restore the backup saved %s?", info.ModTime().Format("2006-01-02 15:04")))
+		if err != nil || !ok {
+			return false, err
+		}
+
+		if err := schemaDAO.Dump(ctx, us, true); err != nil {
+			return false, fmt.Errorf("schemaDAO.Dump() returns err: %w", err)
+		}
+		return true, in.userMessenger.Send("Restored.")
+	}
+
+	return false, nil
+}
+
+// checkData only reports on the records, they're never worth risking.
+func (in *Initializer) checkData(ctx context.Context, dataDAO dao.UserDataDAO) error {
+	records, err := dataDAO.List(ctx, nil)
+	if err != nil {
+		return in.userMessenger.Send(fmt.Sprintf("Your records can't be read: %v\nNothing was changed, fix or move them aside and run init again.", err))
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	return in.userMessenger.Send(fmt.Sprintf("Found %d records, keeping them.", len(records)))
+}
+
+func (in *Initializer) setUpReminders(ctx context.Context) error {
+	current := defaultSchedule
+	if in.config.ReminderSchedule != "" {
+		current = in.config.ReminderSchedule
+	} else if settings, err := reminder.LoadSettings(in.config.ReminderSettingsPath); err == nil {
+		current = settings.Schedule
+	}
+
+	userInput, err := in.ask(
+		ctx,
+		fmt.Sprintf("When would you like to be reminded to log? E.g. \"every 30 minutes, 9:00-18:00, Mon-Fri\" or \"never\". [%s]", current),
+		func(ui *constructs.UserInput) error {
+			if ui.Text == "" {
+				return nil
+			}
+			_, err := reminder.ParseSchedule(ui.Text)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if userInput.Text == "" {
+		userInput.Text = current
+	}
+
+	schedule, err := reminder.ParseSchedule(userInput.Text)
+	if err != nil {
+		return fmt.Errorf("reminder.ParseSchedule(%s) returns err: %w", userInput.Text, err)
+	}
+
+	// A schedule in the config file would hide the saved one.
+	if in.config.ReminderSchedule != "" {
+		in.config.ReminderSchedule = schedule.String()
+	}
+
+	return reminder.SaveSettings(in.config.ReminderSettingsPath, &reminder.Settings{Schedule: schedule.String()})
+}
+
+func (in *Initializer) setUpNotifier(ctx context.Context) error {
+	kinds := []string{string(notifier.KindTerminal), string(notifier.KindDesktop), string(notifier.KindCommand)}
+	kind, err := in.choose(ctx, "How should reminders reach you? The terminal bell, a desktop notification, or a command you pick?", kinds, in.config.Notifier)
+	if err != nil {
+		return err
+	}
+	in.config.Notifier = kind
+
+	if notifier.Kind(kind) == notifier.KindDesktop {
+		if _, err := notifier.NewDesktop(); err != nil {
+			return in.userMessenger.Send(fmt.Sprintf("Desktop notifications won't work yet: %v", err))
+		}
+		return nil
+	}
+
+	if notifier.Kind(kind) != notifier.KindCommand {
+		return nil
+	}
+
+	userInput, err := in.ask(ctx, fmt.Sprintf("Which command? It gets the reminder as its last argument. [%s]", in.config.NotifyCommand), func(ui *constructs.UserInput) error {
+		command := ui.Text
+		if command == "" {
+			command = in.config.NotifyCommand
+		}
+		_, err := notifier.NewCommand(command)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if userInput.Text != "" {
+		in.config.NotifyCommand = userInput.Text
+	}
+
+	return nil
+}
+
+func (in *Initializer) saveConfig() error {
+	values := map[string]string{
+		"backend":  in.config.Backend,
+		"dir":      in.config.Dir,
+		"notifier": in.config.Notifier,
+	}
+	if in.config.NotifyCommand != "" {
+		values["notify-command"] = in.config.NotifyCommand
+	}
+	if in.config.ReminderSchedule != "" {
+		values["reminder-schedule"] = in.config.ReminderSchedule
+	}
+
+	dropped, err := config.SaveFile(in.config.ConfigPath, values)
+	if err != nil {
+		return fmt.Errorf("config.SaveFile(%s) returns err: %w", in.config.ConfigPath, err)
+	}
+
+	msg := fmt.Sprintf("Saved your settings to %s. Run activity_log init any time to change or repair them.", in.config.ConfigPath)
+	if len(dropped) > 0 {
+		msg = fmt.Sprintf("Dropped settings that didn't work: %s.\n%s", strings.Join(dropped, ", "), msg)
+	}
+	return in.userMessenger.Send(msg)
+}
+
+// choose asks question until the answer is one of options, Enter picks current.
+func (in *Initializer) choose(ctx context.Context, question string, options []string, current string) (string, error) {
+	userInput, err := in.ask(ctx, fmt.Sprintf("%s (%s) [%s]", question, strings.Join(options, "/"), current), func(ui *constructs.UserInput) error {
+		if ui.Text == "" {
+			return nil
+		}
+		for _, option := range options {
+			if strings.ToLower(ui.Text) == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("please answer one of %s", strings.Join(options, ", "))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if userInput.Text == "" {
+		return current, nil
+	}
+	return strings.ToLower(userInput.Text), nil
+}
+
+func (in *Initializer) confirm(ctx context.Context, question string) (bool, error) {
+	answer, err := in.choose(ctx, question, []string{"yes", "no"}, "yes")
+	if err != nil {
+		return false, err
+	}
+	return answer == "yes", nil
 }
 
-func (init *Initializer) Init() error {
-	return fmt.Errorf("not yet implemented")
+// ask waits as long as it takes, setting up isn't something to rush.
+func (in *Initializer) ask(ctx context.Context, question string, invariants func(*constructs.UserInput) error) (*constructs.UserInput, error) {
+	return in.userListener.Ask(ctx, question, 0, in.config.MaxConfusionRetries, invariants)
 }
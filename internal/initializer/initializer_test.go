@@ -0,0 +1,193 @@
+package initializer_test
+
+import (
+	"activity_log/internal/config"
+	schemadao "activity_log/internal/dao/schema_dao"
+	"activity_log/internal/initializer"
+	"activity_log/internal/reminder"
+	"activity_log/internal/user_input"
+	cli "activity_log/internal/user_input/service"
+	"activity_log/internal/user_output"
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestStartersLoad(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("starters", "*.json"))
+	if err != nil {
+		t.Fatalf("Glob() returns err: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no starters found")
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			jsonBytes, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile() returns err: %v", err)
+			}
+			if _, err := schemadao.UnmarshalUserSchema(jsonBytes); err != nil {
+				t.Errorf("UnmarshalUserSchema() returns err: %v", err)
+			}
+		})
+	}
+}
+
+// newTestConfig keeps everything under a temporary directory.
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := config.NewLoader(fs).LoadWithoutFile(func(key string) string {
+		switch key {
+		case "XDG_DATA_HOME":
+			return dir
+		case "ACTIVITY_LOG_CONFIG":
+			return filepath.Join(dir, "config")
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatalf("LoadWithoutFile() returns err: %v", err)
+	}
+	return cfg
+}
+
+// runInit runs Init answering its questions with the lines of script, and
+// returns what it said.
+func runInit(t *testing.T, cfg *config.Config, script string) string {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	messenger := user_output.NewUserMessenger(out)
+	listener := user_input.New(cli.NewCLIListener(strings.NewReader(script)), messenger)
+	if err := initializer.New(listener, messenger, cfg).Init(context.Background()); err != nil {
+		t.Fatalf("Init() returns err: %v\n%s", err, out.String())
+	}
+	return out.String()
+}
+
+func loadKeys(t *testing.T, cfg *config.Config) []string {
+	t.Helper()
+
+	us, err := schemadao.NewLocalSchemaDAO(cfg.SchemaPath, 0).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+	keys := us.Schema.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+func TestInitFirstRun(t *testing.T) {
+	cfg := newTestConfig(t)
+	if !initializer.IsFirstRun(cfg) {
+		t.Fatalf("IsFirstRun() = false before anything was set up, want true")
+	}
+
+	// Keep csv and the directory, start from the life schema, never remind
+	// and use the terminal bell.
+	runInit(t, cfg, "\n\n1\nnever\nterminal\n")
+
+	if initializer.IsFirstRun(cfg) {
+		t.Errorf("IsFirstRun() = true after Init(), want false")
+	}
+	if got := loadKeys(t, cfg); !reflect.DeepEqual(got, []string{"chores", "default", "exercise", "friends_and_family", "reading", "resting", "working"}) {
+		t.Errorf("schema keys after Init(): got %q, want the life starter's", got)
+	}
+
+	settings, err := reminder.LoadSettings(cfg.ReminderSettingsPath)
+	if err != nil {
+		t.Fatalf("LoadSettings() returns err: %v", err)
+	}
+	if settings.Schedule != "never" {
+		t.Errorf("saved schedule: got %q, want %q", settings.Schedule, "never")
+	}
+
+	configBytes, err := ioutil.ReadFile(cfg.ConfigPath)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) returns err: %v", cfg.ConfigPath, err)
+	}
+	for _, want := range []string{"backend", "csv", "terminal"} {
+		if !strings.Contains(string(configBytes), want) {
+			t.Errorf("config file %q is missing %q", configBytes, want)
+		}
+	}
+}
+
+func TestInitRepairsSchema(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		script   string
+		wantKeys []string
+	}{
+		{
+			desc:     "restores the backup",
+			script:   "\n\nyes\nnever\nterminal\n",
+			wantKeys: []string{"reading", "writing"},
+		},
+		{
+			desc:     "starts over instead",
+			script:   "\n\nno\n2\nnever\nterminal\n",
+			wantKeys: []string{"default"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			if err := cfg.MakeDirs(); err != nil {
+				t.Fatalf("MakeDirs() returns err: %v", err)
+			}
+			writeFile(t, cfg.SchemaPath, "{not json")
+			writeFile(t, cfg.SchemaPath+".1", `{"version": 3, "activities": {"reading": {}, "writing": {}}}`)
+
+			out := runInit(t, cfg, tc.script)
+
+			if !strings.Contains(out, "Your schema can't be read") {
+				t.Errorf("Init() says %q, want it to report the broken schema", out)
+			}
+			if got := loadKeys(t, cfg); !reflect.DeepEqual(got, tc.wantKeys) {
+				t.Errorf("schema keys after Init(): got %q, want %q", got, tc.wantKeys)
+			}
+		})
+	}
+}
+
+func TestInitKeepsUnreadableData(t *testing.T) {
+	cfg := newTestConfig(t)
+	if err := cfg.MakeDirs(); err != nil {
+		t.Fatalf("MakeDirs() returns err: %v", err)
+	}
+	broken := "timestamp,id,activity\n\"unterminated\n"
+	writeFile(t, cfg.DataPath, broken)
+
+	out := runInit(t, cfg, "\n\n0\nnever\nterminal\n")
+
+	if !strings.Contains(out, "Your records can't be read") {
+		t.Errorf("Init() says %q, want it to report the broken records", out)
+	}
+	got, err := ioutil.ReadFile(cfg.DataPath)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	if string(got) != broken {
+		t.Errorf("data file after Init(): got %q, want it untouched", got)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile(%s) returns err: %v", path, err)
+	}
+}
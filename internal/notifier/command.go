@@ -0,0 +1,38 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Command runs a user configured command with the message as its last
+// argument, for notification tools this package doesn't know about.
+type Command struct {
+	name string
+	args []string
+}
+
+// NewCommand splits command on whitespace into a program and its leading arguments.
+func NewCommand(command string) (*Command, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("the command notifier needs a command to run")
+	}
+
+	return &Command{
+		name: fields[0],
+		args: fields[1:],
+	}, nil
+}
+
+func (c *Command) Notify(ctx context.Context, message string) error {
+	args := append(append([]string{}, c.args...), message)
+
+	output, err := exec.CommandContext(ctx, c.name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s returns err: %w, output: %s", c.name, err, output)
+	}
+	return nil
+}
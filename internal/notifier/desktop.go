@@ -0,0 +1,56 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// desktopTitle heads every desktop notification.
+const desktopTitle = "activity_log"
+
+// Desktop pops up a notification through the desktop environment: the
+// freedesktop notification service over D-Bus via notify-send on Linux and
+// the BSDs, and Notification Center via osascript on macOS.
+type Desktop struct {
+	command func(ctx context.Context, message string) *exec.Cmd
+}
+
+// NewDesktop returns an error if this platform has no way to notify the desktop.
+func NewDesktop() (*Desktop, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("osascript"); err != nil {
+			return nil, fmt.Errorf("exec.LookPath(osascript) returns err: %w", err)
+		}
+		return &Desktop{command: osascript}, nil
+	case "windows":
+		return nil, fmt.Errorf("desktop notifications aren't supported on %s, use the %s or %s notifier", runtime.GOOS, KindTerminal, KindCommand)
+	default:
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return nil, fmt.Errorf("exec.LookPath(notify-send) returns err: %w", err)
+		}
+		return &Desktop{command: notifySend}, nil
+	}
+}
+
+func (d *Desktop) Notify(ctx context.Context, message string) error {
+	cmd := d.command(ctx, message)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s returns err: %w, output: %s", cmd.Path, err, output)
+	}
+	return nil
+}
+
+func notifySend(ctx context.Context, message string) *exec.Cmd {
+	return exec.CommandContext(ctx, "notify-send", "--app-name", desktopTitle, desktopTitle, message)
+}
+
+func osascript(ctx context.Context, message string) *exec.Cmd {
+	// Passed as arguments, so the message needs no AppleScript quoting.
+	script := `on run argv
+display notification (item 1 of argv) with title (item 2 of argv)
+end run`
+	return exec.CommandContext(ctx, "osascript", "-e", script, message, desktopTitle)
+}
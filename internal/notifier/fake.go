@@ -0,0 +1,31 @@
+package notifier
+
+import (
+	"context"
+	"sync"
+)
+
+// Fake remembers the messages it was asked to show, for tests.
+type Fake struct {
+	// Err, if set, is returned by every Notify.
+	Err error
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func (f *Fake) Notify(_ context.Context, message string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages = append(f.messages, message)
+	return f.Err
+}
+
+// Messages returns every message passed to Notify so far, oldest first.
+func (f *Fake) Messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string{}, f.messages...)
+}
@@ -0,0 +1,37 @@
+// Package notifier reminds the user to log activity.
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Notifier gets a message in front of the user, wherever they are.
+type Notifier interface {
+	Notify(ctx context.Context, message string) error
+}
+
+// Kind names a Notifier implementation in configuration.
+type Kind string
+
+const (
+	KindTerminal Kind = "terminal"
+	KindDesktop  Kind = "desktop"
+	KindCommand  Kind = "command"
+)
+
+// New builds the Notifier of the given kind. command is only used by
+// KindCommand, out only by KindTerminal.
+func New(kind Kind, command string, out io.Writer) (Notifier, error) {
+	switch kind {
+	case KindTerminal:
+		return NewTerminal(out), nil
+	case KindDesktop:
+		return NewDesktop()
+	case KindCommand:
+		return NewCommand(command)
+	default:
+		return nil, fmt.Errorf("unknown notifier %q, want one of %s, %s or %s", kind, KindTerminal, KindDesktop, KindCommand)
+	}
+}
@@ -0,0 +1,80 @@
+package notifier_test
+
+import (
+	"activity_log/internal/notifier"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestTerminal(t *testing.T) {
+	var out bytes.Buffer
+
+	if err := notifier.NewTerminal(&out).Notify(context.Background(), "log your time"); err != nil {
+		t.Fatalf("Notify() returns err: %v", err)
+	}
+
+	if got, want := out.String(), "\alog your time\n"; got != want {
+		t.Errorf("Notify() writes %q, want %q", got, want)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook is a shell script")
+	}
+
+	dir := t.TempDir()
+	hook := filepath.Join(dir, "hook.sh")
+	outPath := filepath.Join(dir, "out")
+	script := "#!/bin/sh\necho \"$1|$2\" > " + outPath + "\n"
+	if err := ioutil.WriteFile(hook, []byte(script), 0755); err != nil {
+		t.Fatalf("WriteFile() returns err: %v", err)
+	}
+
+	n, err := notifier.New(notifier.KindCommand, hook+" --urgent", nil)
+	if err != nil {
+		t.Fatalf("New() returns err: %v", err)
+	}
+
+	if err := n.Notify(context.Background(), "log your time"); err != nil {
+		t.Fatalf("Notify() returns err: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("ReadFile() returns err: %v", err)
+	}
+	if want := "--urgent|log your time\n"; string(got) != want {
+		t.Errorf("hook got %q, want %q", got, want)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		kind    notifier.Kind
+		command string
+	}{
+		{
+			desc: "unknown kind",
+			kind: "carrier-pigeon",
+		},
+		{
+			desc:    "command without a command",
+			kind:    notifier.KindCommand,
+			command: "  ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if _, err := notifier.New(tc.kind, tc.command, nil); err == nil {
+				t.Errorf("New(%q, %q) should return err", tc.kind, tc.command)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Terminal rings the terminal bell and prints the message.
+type Terminal struct {
+	out io.Writer
+}
+
+func NewTerminal(out io.Writer) *Terminal {
+	return &Terminal{
+		out: out,
+	}
+}
+
+func (t *Terminal) Notify(_ context.Context, message string) error {
+	if _, err := fmt.Fprintf(t.out, "\a%s\n", message); err != nil {
+		return fmt.Errorf("fmt.Fprintf() returns err: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+// Package reminder decides when to remind the user to log activity.
+package reminder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is when reminders are due: every Interval, between From and Until
+// on Weekdays. A zero Interval means never.
+type Schedule struct {
+	Interval time.Duration
+	// From and Until are offsets from midnight, both zero for all day.
+	// Until is inclusive.
+	From  time.Duration
+	Until time.Duration
+	// Weekdays is every day when empty.
+	Weekdays []time.Weekday
+}
+
+// dashes separate the ends of hour and day ranges, however they were typed.
+var dashes = strings.NewReplacer("–", "-", "—", "-", " to ", "-")
+
+var weekdayNames = map[string]time.Weekday{}
+
+func init() {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		weekdayNames[strings.ToLower(day.String())] = day
+		weekdayNames[strings.ToLower(day.String()[:3])] = day
+	}
+}
+
+// ParseSchedule reads comma separated parts like
+// "every 30 minutes, 9:00–18:00, Mon–Fri". A bare number is an interval in
+// minutes and "never" or "0" turns reminders off.
+func ParseSchedule(text string) (*Schedule, error) {
+	schedule := &Schedule{}
+
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "never" || text == "0" {
+		return schedule, nil
+	}
+
+	for _, part := range strings.Split(dashes.Replace(text), ",") {
+		part = strings.TrimSpace(part)
+
+		switch {
+		case part == "":
+			continue
+		case isInterval(part):
+			interval, err := parseInterval(strings.TrimPrefix(part, "every "))
+			if err != nil {
+				return nil, fmt.Errorf("parseInterval(%s) returns err: %w", part, err)
+			}
+			schedule.Interval = interval
+		case strings.Contains(part, ":"):
+			from, until, err := parseHours(part)
+			if err != nil {
+				return nil, fmt.Errorf("parseHours(%s) returns err: %w", part, err)
+			}
+			schedule.From, schedule.Until = from, until
+		default:
+			days, err := parseDays(part)
+			if err != nil {
+				return nil, fmt.Errorf("parseDays(%s) returns err: %w", part, err)
+			}
+			schedule.Weekdays = append(schedule.Weekdays, days...)
+		}
+	}
+
+	if schedule.Interval <= 0 {
+		return nil, fmt.Errorf("%q doesn't say how often, e.g. \"every 30 minutes\"", text)
+	}
+
+	return schedule, nil
+}
+
+// isInterval reports whether part says how often, rather than on which
+// days, which "every day" does.
+func isInterval(part string) bool {
+	if part == "every day" {
+		return false
+	}
+	return strings.HasPrefix(part, "every ") || isNumber(part)
+}
+
+func isNumber(text string) bool {
+	_, err := strconv.Atoi(text)
+	return err == nil
+}
+
+func parseInterval(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+
+	switch text {
+	case "minute":
+		return time.Minute, nil
+	case "hour":
+		return time.Hour, nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 1 {
+		if minutes, err := strconv.Atoi(text); err == nil && minutes > 0 {
+			return time.Duration(minutes) * time.Minute, nil
+		}
+		if d, err := time.ParseDuration(text); err == nil && d > 0 {
+			return d, nil
+		}
+	}
+
+	if len(fields) == 2 {
+		count, err := strconv.Atoi(fields[0])
+		if err != nil || count <= 0 {
+			return 0, fmt.Errorf("%q isn't a positive number", fields[0])
+		}
+
+		switch fields[1] {
+		case "minute", "minutes", "min", "mins":
+			return time.Duration(count) * time.Minute, nil
+		case "hour", "hours":
+			return time.Duration(count) * time.Hour, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%q isn't an interval like \"30 minutes\" or \"2 hours\"", text)
+}
+
+func parseHours(text string) (time.Duration, time.Duration, error) {
+	ends := strings.Split(text, "-")
+	if len(ends) != 2 {
+		return 0, 0, fmt.Errorf("%q isn't a range of hours like 9:00-18:00", text)
+	}
+
+	from, err := parseClock(ends[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	until, err := parseClock(ends[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if until <= from {
+		return 0, 0, fmt.Errorf("%q ends before it starts", text)
+	}
+
+	return from, until, nil
+}
+
+func parseClock(text string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(text))
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a time of day like 9:00", text)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseDays(text string) ([]time.Weekday, error) {
+	switch text {
+	case "daily", "every day":
+		return nil, nil
+	case "weekdays":
+		return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, nil
+	case "weekends":
+		return []time.Weekday{time.Saturday, time.Sunday}, nil
+	}
+
+	ends := strings.Split(text, "-")
+	if len(ends) > 2 {
+		return nil, fmt.Errorf("%q isn't a day or range of days like Mon-Fri", text)
+	}
+
+	first, ok := weekdayNames[strings.TrimSpace(ends[0])]
+	if !ok {
+		return nil, fmt.Errorf("%q isn't a day of the week", ends[0])
+	}
+	if len(ends) == 1 {
+		return []time.Weekday{first}, nil
+	}
+
+	last, ok := weekdayNames[strings.TrimSpace(ends[1])]
+	if !ok {
+		return nil, fmt.Errorf("%q isn't a day of the week", ends[1])
+	}
+
+	// Ranges may wrap around the weekend, e.g. Fri-Mon.
+	days := []time.Weekday{first}
+	for day := first; day != last; {
+		day = (day + 1) % 7
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// String writes the schedule back in the form ParseSchedule reads.
+func (s *Schedule) String() string {
+	if s.Interval <= 0 {
+		return "never"
+	}
+
+	parts := []string{"every " + formatInterval(s.Interval)}
+
+	if s.hasWindow() {
+		parts = append(parts, fmt.Sprintf("%s-%s", formatClock(s.From), formatClock(s.Until)))
+	}
+
+	if len(s.Weekdays) > 0 {
+		parts = append(parts, formatDays(s.Weekdays)...)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func formatInterval(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "hour"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%d:%02d", d/time.Hour, (d%time.Hour)/time.Minute)
+}
+
+// formatDays writes runs of consecutive days Monday first, e.g. [Mon-Fri Sun].
+func formatDays(weekdays []time.Weekday) []string {
+	on := map[time.Weekday]bool{}
+	for _, day := range weekdays {
+		on[day] = true
+	}
+
+	mondayFirst := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+	parts := []string{}
+	for idx := 0; idx < len(mondayFirst); idx++ {
+		if !on[mondayFirst[idx]] {
+			continue
+		}
+
+		end := idx
+		for end+1 < len(mondayFirst) && on[mondayFirst[end+1]] {
+			end++
+		}
+
+		part := mondayFirst[idx].String()[:3]
+		if end > idx {
+			part += "-" + mondayFirst[end].String()[:3]
+		}
+		parts = append(parts, part)
+
+		idx = end
+	}
+	return parts
+}
+
+func (s *Schedule) hasWindow() bool {
+	return s.From != 0 || s.Until != 0
+}
+
+func (s *Schedule) remindsOn(day time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, weekday := range s.Weekdays {
+		if weekday == day {
+			return true
+		}
+	}
+	return false
+}
+
+// window returns the part of day, given as its midnight, that reminders may fall in.
+func (s *Schedule) window(day time.Time) (time.Time, time.Time) {
+	if !s.hasWindow() {
+		return day, day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	atOffset := func(offset time.Duration) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, int(offset/time.Minute), 0, 0, day.Location())
+	}
+	return atOffset(s.From), atOffset(s.Until)
+}
+
+// Next is the first reminder due after the one at {after}, or the zero time
+// if reminders are off. A day's first reminder comes one interval after its
+// window opens, or as the window closes if the interval is longer than it.
+func (s *Schedule) Next(after time.Time) time.Time {
+	if s.Interval <= 0 {
+		return time.Time{}
+	}
+
+	candidate := after.Add(s.Interval)
+	day := time.Date(candidate.Year(), candidate.Month(), candidate.Day(), 0, 0, 0, 0, candidate.Location())
+
+	// A week and a day covers every weekday, and today again.
+	for i := 0; i <= 7; i++ {
+		if s.remindsOn(day.Weekday()) {
+			start, end := s.window(day)
+			if candidate.IsZero() || candidate.Before(start) {
+				candidate = start.Add(s.Interval)
+				if candidate.After(end) {
+					candidate = end
+				}
+			}
+			if !candidate.After(end) {
+				return candidate
+			}
+		}
+
+		day = day.AddDate(0, 0, 1)
+		candidate = time.Time{}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,165 @@
+package reminder_test
+
+import (
+	"activity_log/internal/reminder"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{
+			desc: "full schedule with en dashes",
+			text: "every 30 minutes, 9:00–18:00, Mon–Fri",
+			want: "every 30 minutes, 9:00-18:00, Mon-Fri",
+		},
+		{
+			desc: "every day",
+			text: "every 30 minutes, 9:00-18:00, every day",
+			want: "every 30 minutes, 9:00-18:00",
+		},
+		{
+			desc: "daily",
+			text: "daily, every hour",
+			want: "every hour",
+		},
+		{
+			desc: "bare minutes",
+			text: "45",
+			want: "every 45 minutes",
+		},
+		{
+			desc: "hours and single days",
+			text: "Every 2 hours, sat, Monday",
+			want: "every 2 hours, Mon, Sat",
+		},
+		{
+			desc: "range wrapping the weekend",
+			text: "every hour, 8:30 to 12:00, Fri-Mon",
+			want: "every hour, 8:30-12:00, Mon, Fri-Sun",
+		},
+		{
+			desc: "go duration",
+			text: "every 1h30m, weekdays",
+			want: "every 90 minutes, Mon-Fri",
+		},
+		{
+			desc: "never",
+			text: "never",
+			want: "never",
+		},
+		{
+			desc: "zero",
+			text: "0",
+			want: "never",
+		},
+		{
+			desc:    "no interval",
+			text:    "9:00-17:00",
+			wantErr: true,
+		},
+		{
+			desc:    "hours ending before they start",
+			text:    "every 10 minutes, 18:00-9:00",
+			wantErr: true,
+		},
+		{
+			desc:    "unknown day",
+			text:    "every 10 minutes, Funday",
+			wantErr: true,
+		},
+		{
+			desc:    "negative interval",
+			text:    "every -5 minutes",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			schedule, err := reminder.ParseSchedule(tc.text)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSchedule(%q) returns %v, want err", tc.text, schedule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) returns err: %v", tc.text, err)
+			}
+
+			if got := schedule.String(); got != tc.want {
+				t.Errorf("ParseSchedule(%q).String() = %q, want %q", tc.text, got, tc.want)
+			}
+
+			again, err := reminder.ParseSchedule(schedule.String())
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) doesn't read its own String(): %v", schedule.String(), err)
+			}
+			if again.String() != schedule.String() {
+				t.Errorf("round trip: got %q, want %q", again.String(), schedule.String())
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	schedule, err := reminder.ParseSchedule("every 30 minutes, 9:00-18:00, Mon-Fri")
+	if err != nil {
+		t.Fatalf("ParseSchedule() returns err: %v", err)
+	}
+
+	// 2021-11-12 is a Friday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2021, time.November, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		desc  string
+		after time.Time
+		want  time.Time
+	}{
+		{
+			desc:  "inside the window",
+			after: at(12, 10, 0),
+			want:  at(12, 10, 30),
+		},
+		{
+			desc:  "last reminder of the day is at closing",
+			after: at(12, 17, 30),
+			want:  at(12, 18, 0),
+		},
+		{
+			desc:  "early morning waits for the window",
+			after: at(11, 6, 0),
+			want:  at(11, 9, 30),
+		},
+		{
+			desc:  "friday evening skips the weekend",
+			after: at(12, 18, 0),
+			want:  at(15, 9, 30),
+		},
+		{
+			desc:  "saturday waits for monday",
+			after: at(13, 12, 0),
+			want:  at(15, 9, 30),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := schedule.Next(tc.after); !got.Equal(tc.want) {
+				t.Errorf("Next(%v) = %v, want %v", tc.after, got, tc.want)
+			}
+		})
+	}
+
+	if got := (&reminder.Schedule{}).Next(at(12, 10, 0)); !got.IsZero() {
+		t.Errorf("Next() with reminders off = %v, want the zero time", got)
+	}
+}
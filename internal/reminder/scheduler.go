@@ -0,0 +1,132 @@
+package reminder
+
+import (
+	"activity_log/internal/notifier"
+	"context"
+	"sync"
+	"time"
+)
+
+// Message is what the user is reminded with.
+const Message = "Reminder to log activity!"
+
+// Scheduler notifies the user whenever the schedule says to, unless they're
+// busy logging already or asked to be left alone for a while.
+type Scheduler struct {
+	clock    Clock
+	notifier notifier.Notifier
+	// busy reports whether the user is in the middle of logging.
+	busy func() bool
+	// report hears about reminders that couldn't be sent.
+	report func(error)
+
+	mu           sync.Mutex
+	schedule     *Schedule
+	snoozedUntil time.Time
+	// wake interrupts Run's wait when the schedule or snooze changes.
+	wake chan struct{}
+}
+
+func NewScheduler(
+	schedule *Schedule,
+	clock Clock,
+	notifier notifier.Notifier,
+	busy func() bool,
+	report func(error),
+) *Scheduler {
+	return &Scheduler{
+		schedule: schedule,
+		clock:    clock,
+		notifier: notifier,
+		busy:     busy,
+		report:   report,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Run sends reminders until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	last := s.clock.Now()
+	for {
+		next, snoozed := s.next(last)
+
+		var (
+			timer Timer
+			due   <-chan time.Time
+		)
+		if !next.IsZero() {
+			timer = s.clock.NewTimer(next.Sub(s.clock.Now()))
+			due = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			stopTimer(timer)
+			return ctx.Err()
+		case <-s.wake:
+			// The schedule or snooze changed, so this timer is no longer wanted.
+			stopTimer(timer)
+			continue
+		case <-due:
+		}
+
+		last = next
+		if snoozed {
+			s.mu.Lock()
+			s.snoozedUntil = time.Time{}
+			s.mu.Unlock()
+		}
+
+		if s.busy() {
+			continue
+		}
+
+		if err := s.notifier.Notify(ctx, Message); err != nil && ctx.Err() == nil {
+			s.report(err)
+		}
+	}
+}
+
+// Snooze holds off every reminder for d, then reminds once and carries on
+// with the schedule from there.
+func (s *Scheduler) Snooze(d time.Duration) {
+	s.mu.Lock()
+	s.snoozedUntil = s.clock.Now().Add(d)
+	s.mu.Unlock()
+
+	s.poke()
+}
+
+// SetSchedule replaces the schedule, a zero Interval stops scheduled reminders.
+func (s *Scheduler) SetSchedule(schedule *Schedule) {
+	s.mu.Lock()
+	s.schedule = schedule
+	s.mu.Unlock()
+
+	s.poke()
+}
+
+func stopTimer(timer Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next is when the reminder after the one at last is due, and whether that's a snooze ending.
+func (s *Scheduler) next(last time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.snoozedUntil.IsZero() {
+		return s.snoozedUntil, true
+	}
+
+	return s.schedule.Next(last), false
+}
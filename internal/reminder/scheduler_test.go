@@ -0,0 +1,206 @@
+package reminder_test
+
+import (
+	"activity_log/internal/notifier"
+	"activity_log/internal/reminder"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when Advance is called. Every NewTimer call is announced
+// on waits, which tells a test the scheduler is done with the last tick.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	waiting chan struct{}
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	c     chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{
+		now:     now,
+		waiting: make(chan struct{}, 100),
+	}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) NewTimer(d time.Duration) reminder.Timer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	timer := &fakeTimer{clock: fc, at: fc.now.Add(d), c: make(chan time.Time, 1)}
+	fc.timers = append(fc.timers, timer)
+	fc.waiting <- struct{}{}
+	return timer
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.now = fc.now.Add(d)
+	pending := fc.timers[:0]
+	for _, timer := range fc.timers {
+		if timer.at.After(fc.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.c <- fc.now
+	}
+	fc.timers = pending
+}
+
+// pending is how many timers are yet to fire.
+func (fc *fakeClock) pending() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return len(fc.timers)
+}
+
+func (ft *fakeTimer) C() <-chan time.Time {
+	return ft.c
+}
+
+func (ft *fakeTimer) Stop() bool {
+	fc := ft.clock
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	for i, timer := range fc.timers {
+		if timer == ft {
+			fc.timers = append(fc.timers[:i], fc.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// waitForScheduler blocks until the scheduler is waiting on the clock again.
+func (fc *fakeClock) waitForScheduler(t *testing.T) {
+	t.Helper()
+	select {
+	case <-fc.waiting:
+	case <-time.After(time.Second):
+		t.Fatalf("the scheduler never waited on the clock")
+	}
+}
+
+func startScheduler(t *testing.T, schedule string, busy func() bool) (*reminder.Scheduler, *fakeClock, *notifier.Fake) {
+	t.Helper()
+
+	parsed, err := reminder.ParseSchedule(schedule)
+	if err != nil {
+		t.Fatalf("ParseSchedule() returns err: %v", err)
+	}
+
+	// A Friday morning.
+	clock := newFakeClock(time.Date(2021, time.November, 12, 9, 0, 0, 0, time.UTC))
+	fake := &notifier.Fake{}
+	scheduler := reminder.NewScheduler(parsed, clock, fake, busy, func(err error) {
+		t.Errorf("report(%v)", err)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	clock.waitForScheduler(t)
+	return scheduler, clock, fake
+}
+
+func TestSchedulerReminds(t *testing.T) {
+	_, clock, fake := startScheduler(t, "every 30 minutes", func() bool { return false })
+
+	clock.Advance(29 * time.Minute)
+	if got := len(fake.Messages()); got != 0 {
+		t.Fatalf("%d reminders before the interval passed, want 0", got)
+	}
+
+	clock.Advance(time.Minute)
+	clock.waitForScheduler(t)
+	clock.Advance(30 * time.Minute)
+	clock.waitForScheduler(t)
+
+	messages := fake.Messages()
+	if len(messages) != 2 || messages[0] != reminder.Message {
+		t.Errorf("reminders: got %q, want 2 of %q", messages, reminder.Message)
+	}
+}
+
+func TestSchedulerSkipsWhileBusy(t *testing.T) {
+	var busy int32 = 1
+	_, clock, fake := startScheduler(t, "every 30 minutes", func() bool { return atomic.LoadInt32(&busy) == 1 })
+
+	clock.Advance(30 * time.Minute)
+	clock.waitForScheduler(t)
+	if got := len(fake.Messages()); got != 0 {
+		t.Fatalf("%d reminders while busy, want 0", got)
+	}
+
+	atomic.StoreInt32(&busy, 0)
+	clock.Advance(30 * time.Minute)
+	clock.waitForScheduler(t)
+	if got := len(fake.Messages()); got != 1 {
+		t.Errorf("%d reminders once no longer busy, want 1", got)
+	}
+}
+
+func TestSchedulerSnooze(t *testing.T) {
+	scheduler, clock, fake := startScheduler(t, "every 10 minutes", func() bool { return false })
+
+	scheduler.Snooze(25 * time.Minute)
+	clock.waitForScheduler(t)
+
+	// The reminders due at 10 and 20 minutes are held off.
+	clock.Advance(20 * time.Minute)
+	if got := len(fake.Messages()); got != 0 {
+		t.Fatalf("%d reminders while snoozed, want 0", got)
+	}
+
+	clock.Advance(5 * time.Minute)
+	clock.waitForScheduler(t)
+	if got := len(fake.Messages()); got != 1 {
+		t.Fatalf("%d reminders once the snooze ended, want 1", got)
+	}
+
+	// Then the schedule carries on from the snooze.
+	clock.Advance(10 * time.Minute)
+	clock.waitForScheduler(t)
+	if got := len(fake.Messages()); got != 2 {
+		t.Errorf("%d reminders after the snooze, want 2", got)
+	}
+}
+
+func TestSchedulerStopsReplacedTimers(t *testing.T) {
+	scheduler, clock, _ := startScheduler(t, "every 10 minutes", func() bool { return false })
+
+	for i := 0; i < 3; i++ {
+		scheduler.Snooze(time.Duration(i+1) * time.Hour)
+		clock.waitForScheduler(t)
+	}
+
+	if got := clock.pending(); got != 1 {
+		t.Errorf("%d pending timers after snoozing, want 1", got)
+	}
+}
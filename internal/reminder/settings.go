@@ -0,0 +1,47 @@
+package reminder
+
+import (
+	"activity_log/internal/atomicfile"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Settings is the reminder config file. The schedule is kept as text so the
+// file stays easy to edit by hand.
+type Settings struct {
+	Schedule string `json:"schedule"`
+}
+
+// LoadSettings returns a NotFoundError if nothing has been saved at path yet.
+func LoadSettings(path string) (*Settings, error) {
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(%s) returns err: %w", path, err)
+	}
+
+	settings := &Settings{}
+	if err := json.Unmarshal(jsonBytes, settings); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal(%s) returns err: %w", path, err)
+	}
+
+	return settings, nil
+}
+
+func SaveSettings(path string, settings *Settings) error {
+	jsonBytes, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent(%+v) returns err: %w", settings, err)
+	}
+
+	if err := atomicfile.Write(path, append(jsonBytes, '\n'), 0644); err != nil {
+		return fmt.Errorf("atomicfile.Write(%s) returns err: %w", path, err)
+	}
+
+	return nil
+}
+
+// ParsedSchedule parses the saved schedule.
+func (s *Settings) ParsedSchedule() (*Schedule, error) {
+	return ParseSchedule(s.Schedule)
+}
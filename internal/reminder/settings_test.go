@@ -0,0 +1,29 @@
+package reminder_test
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/internal/reminder"
+	"path/filepath"
+	"testing"
+)
+
+func TestSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reminders.json")
+
+	if _, err := reminder.LoadSettings(path); !apperror.IsNotFoundError(err) {
+		t.Fatalf("LoadSettings() of a missing file returns %v, want a NotFoundError", err)
+	}
+
+	want := &reminder.Settings{Schedule: "every 30 minutes, 9:00-18:00, Mon-Fri"}
+	if err := reminder.SaveSettings(path, want); err != nil {
+		t.Fatalf("SaveSettings() returns err: %v", err)
+	}
+
+	got, err := reminder.LoadSettings(path)
+	if err != nil {
+		t.Fatalf("LoadSettings() returns err: %v", err)
+	}
+	if *got != *want {
+		t.Errorf("LoadSettings() = %+v, want %+v", got, want)
+	}
+}
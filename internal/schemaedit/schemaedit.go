@@ -0,0 +1,495 @@
+// Package schemaedit changes the shape of a schema, and rewrites the
+// activity of every record logged against the part that changed to match.
+package schemaedit
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constants"
+	"activity_log/api/constructs"
+	"activity_log/internal/dao"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TopLevel names the top of the schema as a parent to move activities under.
+const TopLevel = "."
+
+// Edit is a change to the schema, and the rewrite of activities that goes with it.
+type Edit struct {
+	// verb and past describe the edit, e.g. "rename" and "renamed".
+	verb   string
+	past   string
+	object string
+
+	apply func(schema *util.ExpandingMap) error
+	// rewrite is nil if the edit leaves every activity as it is.
+	rewrite func(activity string) (string, bool)
+	// kept matches the records left as they are under an activity the edit
+	// removes or archives, nil if the edit leaves none.
+	kept *constructs.UserDataFilter
+}
+
+// ApplyTo makes the edit to schema alone, e.g. to a copy of the schema held
+// in memory once Apply saved the edit.
+func (e *Edit) ApplyTo(schema *util.ExpandingMap) error {
+	return e.apply(schema)
+}
+
+func (e *Edit) String() string {
+	return fmt.Sprintf("%s %s", e.verb, e.object)
+}
+
+// Rename renames the last part of activity to newName, e.g.
+// working.reconciling_bad_code to working.refactoring.
+func Rename(activity string, newName string) (*Edit, error) {
+	path, err := parseActivity(activity)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateName(newName); err != nil {
+		return nil, err
+	}
+
+	oldName := path[len(path)-1]
+	newPath := append(append([]string{}, path[:len(path)-1]...), newName)
+
+	// Whether the option standing for activity itself is renamed along with it.
+	renamesSelf := false
+	return &Edit{
+		verb:   "rename",
+		past:   "renamed",
+		object: fmt.Sprintf("%s to %s", activity, strings.Join(newPath, ".")),
+		apply: func(schema *util.ExpandingMap) error {
+			subMap, err := schema.GetSubMap(path)
+			if err != nil {
+				return fmt.Errorf("%s is not in your schema", activity)
+			}
+			self, hasSelf := subMap.ToRegularMap()[oldName]
+			_, hasNew := subMap.ToRegularMap()[newName]
+			renamesSelf = hasSelf && self == nil && !hasNew
+
+			return schema.Rename(path, newName)
+		},
+		rewrite: func(activity string) (string, bool) {
+			parts := strings.Split(activity, ".")
+			if !hasPrefix(parts, path) {
+				return "", false
+			}
+			rest := append([]string{}, parts[len(path):]...)
+			if renamesSelf && len(rest) == 1 && rest[0] == oldName {
+				rest[0] = newName
+			}
+			return strings.Join(append(append([]string{}, newPath...), rest...), "."), true
+		},
+	}, nil
+}
+
+// Move moves activity, and everything under it, under newParent, or to the
+// top of the schema if newParent is TopLevel.
+func Move(activity string, newParent string) (*Edit, error) {
+	path, err := parseActivity(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	parentPath := []string{}
+	if newParent != TopLevel {
+		if parentPath, err = parseActivity(newParent); err != nil {
+			return nil, err
+		}
+	}
+	if hasPrefix(parentPath, path) {
+		return nil, fmt.Errorf("can't move %s under itself", activity)
+	}
+	newPath := append(append([]string{}, parentPath...), path[len(path)-1])
+
+	return &Edit{
+		verb:   "move",
+		past:   "moved",
+		object: fmt.Sprintf("%s to %s", activity, strings.Join(newPath, ".")),
+		apply: func(schema *util.ExpandingMap) error {
+			if _, err := schema.GetSubMap(path); err != nil {
+				return fmt.Errorf("%s is not in your schema", activity)
+			}
+			if _, err := schema.GetSubMap(parentPath); err != nil {
+				return fmt.Errorf("%s is not in your schema", newParent)
+			}
+			return schema.Move(path, parentPath)
+		},
+		rewrite: func(activity string) (string, bool) {
+			parts := strings.Split(activity, ".")
+			if !hasPrefix(parts, path) {
+				return "", false
+			}
+			return strings.Join(append(append([]string{}, newPath...), parts[len(path):]...), "."), true
+		},
+	}, nil
+}
+
+// Merge folds activity, and everything under it, into into, e.g. meetings
+// into meeting. Sub-activities both have are merged the same way, at any
+// depth.
+func Merge(activity string, into string) (*Edit, error) {
+	path, err := parseActivity(activity)
+	if err != nil {
+		return nil, err
+	}
+	intoPath, err := parseActivity(into)
+	if err != nil {
+		return nil, err
+	}
+	if hasPrefix(intoPath, path) || hasPrefix(path, intoPath) {
+		return nil, fmt.Errorf("can't merge %s and %s, one is under the other", activity, into)
+	}
+
+	fromName := path[len(path)-1]
+	intoName := intoPath[len(intoPath)-1]
+	// merged is the schema as of the last apply, to tell where records go,
+	// fromSelf whether activity had an option standing for itself and
+	// intoWasLeaf whether into had no options of its own before.
+	var merged *util.ExpandingMap
+	fromSelf := false
+	intoWasLeaf := false
+	return &Edit{
+		verb:   "merge",
+		past:   "merged",
+		object: fmt.Sprintf("%s into %s", activity, into),
+		apply: func(schema *util.ExpandingMap) error {
+			for _, p := range [][]string{path, intoPath} {
+				if _, err := schema.GetSubMap(p); err != nil {
+					return fmt.Errorf("%s is not in your schema", strings.Join(p, "."))
+				}
+			}
+			fromMap, _ := schema.GetSubMap(path)
+			self, hasSelf := fromMap.ToRegularMap()[fromName]
+			fromSelf = hasSelf && self == nil
+			intoMap, _ := schema.GetSubMap(intoPath)
+			intoWasLeaf = intoMap.IsEmpty()
+
+			merged = schema
+			return schema.Fold(path, intoPath)
+		},
+		rewrite: func(activity string) (string, bool) {
+			parts := strings.Split(activity, ".")
+			if intoWasLeaf && len(parts) == len(intoPath) && hasPrefix(parts, intoPath) {
+				// into's own records join those merged into the option standing for it.
+				if _, err := merged.GetSubMap(append(append([]string{}, intoPath...), intoName)); err == nil {
+					return strings.Join(append(parts, intoName), "."), true
+				}
+				return "", false
+			}
+			if !hasPrefix(parts, path) {
+				return "", false
+			}
+			rest := append([]string{}, parts[len(path):]...)
+			if fromSelf && len(rest) == 1 && rest[0] == fromName {
+				rest[0] = intoName
+			}
+			newPath := append(append([]string{}, intoPath...), rest...)
+
+			// Records of what was a leaf go to the option standing for it, if it's no longer one.
+			if subMap, err := merged.GetSubMap(newPath); err == nil && !subMap.IsEmpty() {
+				if _, err := subMap.GetSubMap(newPath[len(newPath)-1:]); err == nil {
+					newPath = append(newPath, newPath[len(newPath)-1])
+				}
+			}
+			return strings.Join(newPath, "."), true
+		},
+	}, nil
+}
+
+// Delete removes activity, and everything under it, from the schema. The
+// records logged against them are moved to recordsTo, or left as they are
+// if it's empty.
+func Delete(activity string, recordsTo string) (*Edit, error) {
+	path, err := parseActivity(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	edit := &Edit{
+		verb:   "delete",
+		past:   "deleted",
+		object: activity,
+		rewrite: func(string) (string, bool) {
+			return "", false
+		},
+		kept: &constructs.UserDataFilter{ActivityPrefix: activity},
+	}
+
+	var toPath []string
+	if recordsTo != "" {
+		if toPath, err = parseActivity(recordsTo); err != nil {
+			return nil, err
+		}
+		if hasPrefix(toPath, path) {
+			return nil, fmt.Errorf("can't move the records of %s to %s, it's deleted along with it", activity, recordsTo)
+		}
+		edit.object = fmt.Sprintf("%s, moving its records to %s", activity, recordsTo)
+		edit.rewrite = func(activity string) (string, bool) {
+			if !hasPrefix(strings.Split(activity, "."), path) {
+				return "", false
+			}
+			return recordsTo, true
+		}
+		edit.kept = nil
+	}
+
+	edit.apply = func(schema *util.ExpandingMap) error {
+		if err := schema.Delete(path); err != nil {
+			return fmt.Errorf("%s is not in your schema", activity)
+		}
+		if toPath == nil {
+			return nil
+		}
+		if _, err := schema.GetSubMap(toPath); err != nil {
+			return fmt.Errorf("%s is not in your schema", recordsTo)
+		}
+		return nil
+	}
+
+	return edit, nil
+}
+
+// Archive hides activity, and everything under it, from the menu. The
+// records logged against them are left as they are.
+func Archive(activity string) (*Edit, error) {
+	path, err := parseActivity(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Edit{
+		verb:   "archive",
+		past:   "archived",
+		object: activity,
+		apply: func(schema *util.ExpandingMap) error {
+			subMap, err := schema.GetSubMap(path)
+			if err != nil {
+				return fmt.Errorf("%s is not in your schema", activity)
+			}
+			if schema.IsArchived(path) {
+				return fmt.Errorf("%s is already archived", activity)
+			}
+			meta := subMap.Meta()
+			meta.Archived = true
+			return schema.SetMeta(path, meta)
+		},
+		kept: &constructs.UserDataFilter{ActivityPrefix: activity},
+	}, nil
+}
+
+// Unarchive puts activity, archived with Archive, back in the menu.
+func Unarchive(activity string) (*Edit, error) {
+	path, err := parseActivity(activity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Edit{
+		verb:   "unarchive",
+		past:   "unarchived",
+		object: activity,
+		apply: func(schema *util.ExpandingMap) error {
+			subMap, err := schema.GetSubMap(path)
+			if err != nil {
+				return fmt.Errorf("%s is not in your schema", activity)
+			}
+			if !subMap.Meta().Archived {
+				for idx := len(path) - 1; idx > 0; idx-- {
+					if schema.IsArchived(path[:idx]) && !schema.IsArchived(path[:idx-1]) {
+						return fmt.Errorf("%s is archived along with %s, unarchive that instead", activity, strings.Join(path[:idx], "."))
+					}
+				}
+				return fmt.Errorf("%s is not archived", activity)
+			}
+			meta := subMap.Meta()
+			meta.Archived = false
+			return schema.SetMeta(path, meta)
+		},
+	}, nil
+}
+
+// Result is what an edit changed, or would change on a dry run.
+type Result struct {
+	Edit   *Edit
+	DryRun bool
+	// Records are the records whose activity changes, as they were.
+	Records []*constructs.UserData
+	// Kept counts the records left logged against activities the edit removed.
+	Kept int
+	// Timer is the running timer, if the edit changes its activity.
+	Timer *constructs.Timer
+}
+
+// Apply makes edit to the schema schemaDAO holds and rewrites the records
+// of dataDAO, and the running timer of timerDAO if it's not nil, to match.
+// With dryRun it only works out what that would change. The schema is saved
+// before any record is rewritten, and put back if rewriting them fails.
+//
+// The two aren't saved as one: if the process dies between saving the schema
+// and rewriting the records, the records stay logged against the activities
+// the edit removed, as if it had kept them, until they're edited by hand.
+func Apply(ctx context.Context, schemaDAO dao.UserSchemaDAO, dataDAO dao.UserDataDAO, timerDAO dao.TimerDAO, edit *Edit, dryRun bool) (*Result, error) {
+	us, err := schemaDAO.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("schemaDAO.Load() returns err: %w", err)
+	}
+	original := &constructs.UserSchema{Schema: us.Schema.Copy()}
+
+	if err := edit.apply(us.Schema); err != nil {
+		return nil, err
+	}
+
+	result := &Result{Edit: edit, DryRun: dryRun}
+	if edit.kept != nil {
+		kept, err := dataDAO.List(ctx, edit.kept)
+		if err != nil {
+			return nil, fmt.Errorf("dataDAO.List() returns err: %w", err)
+		}
+		result.Kept = len(kept)
+	}
+
+	if timerDAO != nil {
+		timer, err := timerDAO.LoadTimer(ctx)
+		if err != nil && !apperror.IsNotFoundError(err) {
+			return nil, fmt.Errorf("timerDAO.LoadTimer() returns err: %w", err)
+		}
+		if timer != nil && edit.rewrite != nil {
+			if to, ok := edit.rewrite(timer.Activity); ok && to != timer.Activity {
+				result.Timer = timer
+			}
+		}
+	}
+
+	// The schema goes first, so a conflict with another process fails the
+	// edit before any record is touched.
+	if !dryRun {
+		if err := schemaDAO.Dump(ctx, us, false); err != nil {
+			return nil, fmt.Errorf("schemaDAO.Dump() returns err: %w", err)
+		}
+	}
+
+	if edit.rewrite != nil {
+		result.Records, err = dataDAO.RewriteActivities(ctx, edit.rewrite, dryRun)
+		if err != nil && !dryRun {
+			if restoreErr := schemaDAO.Dump(ctx, original, false); restoreErr != nil {
+				return nil, fmt.Errorf("dataDAO.RewriteActivities() returns err: %v, and putting the schema back returns err: %w", err, restoreErr)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dataDAO.RewriteActivities() returns err: %w", err)
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if result.Timer != nil {
+		to, _ := edit.rewrite(result.Timer.Activity)
+		if err := timerDAO.SaveTimer(ctx, &constructs.Timer{Activity: to, StartMS: result.Timer.StartMS}); err != nil {
+			return nil, fmt.Errorf("timerDAO.SaveTimer() returns err: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Summary says what the edit did, or would do, and how many records of
+// each activity it rewrote.
+func (r *Result) Summary() string {
+	summary := fmt.Sprintf("%s %s.", capitalize(r.Edit.past), r.Edit.object)
+	if r.DryRun {
+		summary = fmt.Sprintf("Would %s.", r.Edit)
+	}
+
+	counts := map[string]int{}
+	minutes := map[string]int{}
+	totalMinutes := 0
+	for _, record := range r.Records {
+		to, _ := r.Edit.rewrite(record.ActivityPath())
+		move := fmt.Sprintf("%s -> %s", record.ActivityPath(), to)
+		counts[move]++
+		// Records without minutes count for none.
+		if m, err := record.Minutes(); err == nil {
+			minutes[move] += m
+			totalMinutes += m
+		}
+	}
+	moves := []string{}
+	for move := range counts {
+		moves = append(moves, move)
+	}
+	sort.Strings(moves)
+
+	for _, move := range moves {
+		summary += fmt.Sprintf("\n  %s: %s, %s", move, pluralRecords(counts[move]), util.FormatMinutes(minutes[move]))
+	}
+	if len(moves) > 1 {
+		summary += fmt.Sprintf("\n  in all: %s, %s", pluralRecords(len(r.Records)), util.FormatMinutes(totalMinutes))
+	}
+	if r.Timer != nil {
+		to, _ := r.Edit.rewrite(r.Timer.Activity)
+		summary += fmt.Sprintf("\n  the running timer: %s -> %s", r.Timer.Activity, to)
+	}
+	if r.Kept > 0 {
+		summary += fmt.Sprintf("\n  %s left logged against %s as before.", pluralRecords(r.Kept), r.Edit.object)
+	}
+
+	return summary
+}
+
+// capitalize uppercases the first letter of text, e.g. renamed to Renamed.
+func capitalize(text string) string {
+	first, size := utf8.DecodeRuneInString(text)
+	if first == utf8.RuneError {
+		return text
+	}
+	return string(unicode.ToUpper(first)) + text[size:]
+}
+
+func pluralRecords(count int) string {
+	if count == 1 {
+		return "1 record"
+	}
+	return fmt.Sprintf("%d records", count)
+}
+
+// parseActivity splits activity into its path, refusing the default first
+// option, which the menu relies on.
+func parseActivity(activity string) ([]string, error) {
+	path := strings.Split(activity, ".")
+	for _, name := range path {
+		if name == "" {
+			return nil, fmt.Errorf("%q has an empty part", activity)
+		}
+	}
+	if len(path) == 1 && path[0] == constants.DEFAULT_FIRST_OPTION {
+		return nil, fmt.Errorf("%q can't be changed", activity)
+	}
+	return path, nil
+}
+
+func validateName(name string) error {
+	if name == "" || strings.ContainsAny(name, ". \t") {
+		return fmt.Errorf("%q can't name an activity, it needs to be a single word without dots", name)
+	}
+	return nil
+}
+
+func hasPrefix(path []string, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for idx := range prefix {
+		if path[idx] != prefix[idx] {
+			return false
+		}
+	}
+	return true
+}
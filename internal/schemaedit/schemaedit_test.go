@@ -0,0 +1,319 @@
+package schemaedit_test
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/api/constructs"
+	"activity_log/internal/dao"
+	datadao "activity_log/internal/dao/data_dao"
+	schemadao "activity_log/internal/dao/schema_dao"
+	timerdao "activity_log/internal/dao/timer_dao"
+	"activity_log/internal/schemaedit"
+	"activity_log/internal/util"
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		desc string
+		edit func() (*schemaedit.Edit, error)
+		// wantSchema is working's part of the schema after the edit.
+		wantSchema   map[string]interface{}
+		wantActivity []string
+		wantTimer    string
+		wantKept     int
+	}{
+		{
+			desc: "rename",
+			edit: func() (*schemaedit.Edit, error) { return schemaedit.Rename("working.coding", "programming") },
+			wantSchema: map[string]interface{}{
+				"programming": map[string]interface{}{
+					"programming":          nil,
+					"reconciling_bad_code": nil,
+				},
+				"SideProject": nil,
+			},
+			wantActivity: []string{"working.programming.programming", "working.programming.reconciling_bad_code", "working.SideProject"},
+			wantTimer:    "working.programming.reconciling_bad_code",
+		},
+		{
+			desc: "move to the top",
+			edit: func() (*schemaedit.Edit, error) { return schemaedit.Move("working.SideProject", schemaedit.TopLevel) },
+			wantSchema: map[string]interface{}{
+				"coding": map[string]interface{}{
+					"coding":               nil,
+					"reconciling_bad_code": nil,
+				},
+			},
+			wantActivity: []string{"working.coding.coding", "working.coding.reconciling_bad_code", "SideProject"},
+			wantTimer:    "working.coding.reconciling_bad_code",
+		},
+		{
+			desc: "merge a leaf into the option standing for the activity",
+			edit: func() (*schemaedit.Edit, error) { return schemaedit.Merge("working.SideProject", "working.coding") },
+			wantSchema: map[string]interface{}{
+				"coding": map[string]interface{}{
+					"coding":               nil,
+					"reconciling_bad_code": nil,
+				},
+			},
+			wantActivity: []string{"working.coding.coding", "working.coding.reconciling_bad_code", "working.coding.coding"},
+			wantTimer:    "working.coding.reconciling_bad_code",
+		},
+		{
+			desc: "merge into a leaf that gains options",
+			edit: func() (*schemaedit.Edit, error) { return schemaedit.Merge("working.coding", "working.SideProject") },
+			wantSchema: map[string]interface{}{
+				"SideProject": map[string]interface{}{
+					"SideProject":          nil,
+					"reconciling_bad_code": nil,
+				},
+			},
+			// SideProject's own record ends up with coding's, not apart at SideProject.
+			wantActivity: []string{"working.SideProject.SideProject", "working.SideProject.reconciling_bad_code", "working.SideProject.SideProject"},
+			wantTimer:    "working.SideProject.reconciling_bad_code",
+		},
+		{
+			desc: "delete moving records",
+			edit: func() (*schemaedit.Edit, error) {
+				return schemaedit.Delete("working.coding.reconciling_bad_code", "working.coding.coding")
+			},
+			wantSchema: map[string]interface{}{
+				"coding": map[string]interface{}{
+					"coding": nil,
+				},
+				"SideProject": nil,
+			},
+			wantActivity: []string{"working.coding.coding", "working.coding.coding", "working.SideProject"},
+			wantTimer:    "working.coding.coding",
+		},
+		{
+			desc: "delete keeping records",
+			edit: func() (*schemaedit.Edit, error) { return schemaedit.Delete("working.coding", "") },
+			wantSchema: map[string]interface{}{
+				"SideProject": nil,
+			},
+			wantActivity: []string{"working.coding.coding", "working.coding.reconciling_bad_code", "working.SideProject"},
+			wantTimer:    "working.coding.reconciling_bad_code",
+			wantKept:     2,
+		},
+		{
+			desc: "archive keeps the activity and its records",
+			edit: func() (*schemaedit.Edit, error) { return schemaedit.Archive("working.coding") },
+			wantSchema: map[string]interface{}{
+				"coding": map[string]interface{}{
+					"coding":               nil,
+					"reconciling_bad_code": nil,
+				},
+				"SideProject": nil,
+			},
+			wantActivity: []string{"working.coding.coding", "working.coding.reconciling_bad_code", "working.SideProject"},
+			wantTimer:    "working.coding.reconciling_bad_code",
+			wantKept:     2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			schemaDAO := schemadao.NewLocalSchemaDAO(filepath.Join(dir, "schema.json"), 0)
+			dataDAO := datadao.NewDataDAO(filepath.Join(dir, "data.csv"))
+			timerDAO := timerdao.NewLocalTimerDAO(filepath.Join(dir, "timer.json"))
+
+			schema, err := util.NewExpandingMap(map[string]interface{}{
+				"default": nil,
+				"working": map[string]interface{}{
+					"coding": map[string]interface{}{
+						"coding":               nil,
+						"reconciling_bad_code": nil,
+					},
+					"SideProject": nil,
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewExpandingMap() returns err: %v", err)
+			}
+			if err := schemaDAO.Dump(ctx, &constructs.UserSchema{Schema: schema}, true); err != nil {
+				t.Fatalf("Dump() returns err: %v", err)
+			}
+			for idx, activity := range []string{"working.coding.coding", "working.coding.reconciling_bad_code", "working.SideProject"} {
+				record := &constructs.UserData{
+					Data: map[string]interface{}{
+						string(constructs.Activity):     activity,
+						string(constructs.MinutesSpent): 10,
+					},
+					TimestampMS: int64(idx+1) * 1000,
+				}
+				if err := dataDAO.Append(ctx, record); err != nil {
+					t.Fatalf("Append() returns err: %v", err)
+				}
+			}
+			if err := timerDAO.SaveTimer(ctx, &constructs.Timer{Activity: "working.coding.reconciling_bad_code", StartMS: 5000}); err != nil {
+				t.Fatalf("SaveTimer() returns err: %v", err)
+			}
+
+			edit, err := tc.edit()
+			if err != nil {
+				t.Fatalf("edit returns err: %v", err)
+			}
+
+			preview, err := schemaedit.Apply(ctx, schemaDAO, dataDAO, timerDAO, edit, true)
+			if err != nil {
+				t.Fatalf("Apply() dry run returns err: %v", err)
+			}
+			result, err := schemaedit.Apply(ctx, schemaDAO, dataDAO, timerDAO, edit, false)
+			if err != nil {
+				t.Fatalf("Apply() returns err: %v", err)
+			}
+			if len(preview.Records) != len(result.Records) || preview.Kept != result.Kept {
+				t.Errorf("Apply() dry run previews %d records and %d kept, then changes %d and keeps %d", len(preview.Records), preview.Kept, len(result.Records), result.Kept)
+			}
+			if result.Kept != tc.wantKept {
+				t.Errorf("Apply() keeps %d records, want %d", result.Kept, tc.wantKept)
+			}
+
+			us, err := schemaDAO.Load(ctx)
+			if err != nil {
+				t.Fatalf("Load() returns err: %v", err)
+			}
+			working, err := us.Schema.GetSubMap([]string{"working"})
+			if err != nil {
+				t.Fatalf("GetSubMap(working) returns err: %v", err)
+			}
+			if err := util.NestedMapsEqual(tc.wantSchema, working.ToRegularMap()); err != nil {
+				t.Errorf("Apply() leaves working as %+v, want %+v", working.ToRegularMap(), tc.wantSchema)
+			}
+
+			records, err := dataDAO.List(ctx, nil)
+			if err != nil {
+				t.Fatalf("List() returns err: %v", err)
+			}
+			activities := []string{}
+			for _, record := range records {
+				activities = append(activities, record.ActivityPath())
+			}
+			if !reflect.DeepEqual(activities, tc.wantActivity) {
+				t.Errorf("Apply() leaves activities %v, want %v", activities, tc.wantActivity)
+			}
+
+			timer, err := timerDAO.LoadTimer(ctx)
+			if err != nil {
+				t.Fatalf("LoadTimer() returns err: %v", err)
+			}
+			if timer.Activity != tc.wantTimer || timer.StartMS != 5000 {
+				t.Errorf("Apply() leaves the timer at %+v, want %s since 5000", timer, tc.wantTimer)
+			}
+		})
+	}
+}
+
+func TestApplyRejects(t *testing.T) {
+	testCases := []struct {
+		desc string
+		edit func() (*schemaedit.Edit, error)
+	}{
+		{desc: "rename default", edit: func() (*schemaedit.Edit, error) { return schemaedit.Rename("default", "other") }},
+		{desc: "rename to a dotted name", edit: func() (*schemaedit.Edit, error) { return schemaedit.Rename("working", "a.b") }},
+		{desc: "move under itself", edit: func() (*schemaedit.Edit, error) { return schemaedit.Move("working", "working.coding") }},
+		{desc: "merge into its own sub-activity", edit: func() (*schemaedit.Edit, error) { return schemaedit.Merge("working", "working.coding") }},
+		{desc: "delete onto itself", edit: func() (*schemaedit.Edit, error) { return schemaedit.Delete("working", "working.coding") }},
+		{desc: "archive default", edit: func() (*schemaedit.Edit, error) { return schemaedit.Archive("default") }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if _, err := tc.edit(); err == nil {
+				t.Errorf("edit returns no err, want one")
+			}
+		})
+	}
+}
+
+// conflictingSchemaDAO fails every Dump as if another process saved first.
+type conflictingSchemaDAO struct {
+	dao.UserSchemaDAO
+}
+
+func (csd *conflictingSchemaDAO) Dump(context.Context, *constructs.UserSchema, bool) error {
+	return apperror.NewConflictError(fmt.Errorf("saved by another process"))
+}
+
+func TestApplyDumpFails(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	schemaDAO := schemadao.NewLocalSchemaDAO(filepath.Join(dir, "schema.json"), 0)
+	dataDAO := datadao.NewDataDAO(filepath.Join(dir, "data.csv"))
+
+	schema, err := util.NewExpandingMap(map[string]interface{}{
+		"default": nil,
+		"working": map[string]interface{}{
+			"coding":  nil,
+			"meeting": nil,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewExpandingMap() returns err: %v", err)
+	}
+	if err := schemaDAO.Dump(ctx, &constructs.UserSchema{Schema: schema}, true); err != nil {
+		t.Fatalf("Dump() returns err: %v", err)
+	}
+	record := &constructs.UserData{
+		Data: map[string]interface{}{
+			string(constructs.Activity):     "working.coding",
+			string(constructs.MinutesSpent): 10,
+		},
+		TimestampMS: 1000,
+	}
+	if err := dataDAO.Append(ctx, record); err != nil {
+		t.Fatalf("Append() returns err: %v", err)
+	}
+
+	edit, err := schemaedit.Rename("working", "work")
+	if err != nil {
+		t.Fatalf("Rename() returns err: %v", err)
+	}
+	if _, err := schemaedit.Apply(ctx, &conflictingSchemaDAO{schemaDAO}, dataDAO, nil, edit, false); !apperror.IsConflictError(err) {
+		t.Fatalf("Apply() returns %v, want a ConflictError", err)
+	}
+
+	us, err := schemaDAO.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load() returns err: %v", err)
+	}
+	if err := util.NestedMapsEqual(schema.ToRegularMap(), us.Schema.ToRegularMap()); err != nil {
+		t.Errorf("Apply() changed the schema to %+v, want it as it was", us.Schema.ToRegularMap())
+	}
+	records, err := dataDAO.List(ctx, nil)
+	if err != nil {
+		t.Fatalf("List() returns err: %v", err)
+	}
+	if len(records) != 1 || records[0].ActivityPath() != "working.coding" {
+		t.Errorf("Apply() leaves records %+v, want the one at working.coding untouched", records)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	edit, err := schemaedit.Rename("working", "work")
+	if err != nil {
+		t.Fatalf("Rename() returns err: %v", err)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		result *schemaedit.Result
+		want   string
+	}{
+		{desc: "done", result: &schemaedit.Result{Edit: edit}, want: "Renamed working to work."},
+		{desc: "dry run", result: &schemaedit.Result{Edit: edit, DryRun: true}, want: "Would rename working to work."},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := tc.result.Summary(); got != tc.want {
+				t.Errorf("Summary() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,50 +1,119 @@
 package cli
 
 import (
+	"activity_log/api/apperror"
 	"activity_log/api/constructs"
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
+type readResult struct {
+	line string
+	err  error
+	// readAt is when the line came in.
+	readAt time.Time
+}
+
+// CLIListener reads one line of input per call. A single goroutine owns the
+// reader for the life of the listener. A line typed after a call timed out
+// was meant for that call's prompt, so the next call drops it rather than
+// taking it as the answer to a different question.
 type CLIListener struct {
+	input io.Reader
+
+	startOnce sync.Once
+	lines     chan readResult
+	// timedOutAt is when the last call gave up waiting, zero once the call
+	// after it has started.
+	timedOutAt time.Time
 }
 
-// TODO(Luca409): utilize timeout
-func (clil *CLIListener) GetUserInput(timeout time.Duration) (*constructs.UserInput, error) {
-	var inputString string
-	fmt.Scanln(&inputString)
-
-	return &constructs.UserInput{
-		Text: strings.Trim(inputString, "\n"),
-	}, nil
-	// input := make(chan string, 1)
-	// quitChan := make(chan struct{}, 1)
-	// defer func() { quitChan <- struct{}{} }()
-	// go getInput(input, quitChan)
-
-	// for {
-	// 	select {
-	// 	case i := <-input:
-	// 		return &constructs.UserInput{
-	// 			Text: strings.Trim(i, "\n"),
-	// 		}, nil
-	// 	case <-time.After(timeout):
-	// 		return nil, apperror.NewTimeoutError(fmt.Errorf("timed out"), timeout)
-	// 	}
-	// }
+func NewCLIListener(input io.Reader) *CLIListener {
+	return &CLIListener{
+		input: input,
+		lines: make(chan readResult),
+	}
 }
 
-func getInput(input chan string, quitChan chan struct{}) {
+// GetUserInput waits up to timeout for a line, or forever if timeout isn't
+// positive, and gives up with ctx.Err() once ctx is done.
+func (clil *CLIListener) GetUserInput(ctx context.Context, timeout time.Duration) (*constructs.UserInput, error) {
+	clil.startOnce.Do(func() {
+		go clil.readLines()
+	})
+
+	// Only lines that came in since the last timeout and before this call
+	// are stale, later calls take whatever was typed ahead.
+	stale := staleWindow{from: clil.timedOutAt, until: time.Now()}
+	clil.timedOutAt = time.Time{}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
 	for {
 		select {
-		case <-quitChan:
-			return
-		default:
-			var inputString string
-			fmt.Scanln(&inputString)
+		case result, ok := <-clil.lines:
+			if !ok {
+				return nil, io.EOF
+			}
+			if result.err != nil {
+				return nil, result.err
+			}
+			if stale.holds(result) {
+				continue
+			}
+			return &constructs.UserInput{
+				Text: strings.TrimSpace(result.line),
+			}, nil
+		case <-deadline:
+			clil.timedOutAt = time.Now()
+			return nil, apperror.NewTimeoutError(fmt.Errorf("no input"), timeout)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// staleWindow is when lines came in with no prompt waiting for them, after
+// a prompt timed out. A zero from means there was no timeout.
+type staleWindow struct {
+	from  time.Time
+	until time.Time
+}
+
+func (sw staleWindow) holds(result readResult) bool {
+	if sw.from.IsZero() {
+		return false
+	}
+	return result.readAt.After(sw.from) && result.readAt.Before(sw.until)
+}
+
+func (clil *CLIListener) readLines() {
+	defer close(clil.lines)
 
-			input <- inputString
+	reader := bufio.NewReader(clil.input)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Hand over a last line that wasn't newline terminated.
+			if err == io.EOF && line != "" {
+				clil.lines <- readResult{line: line, readAt: time.Now()}
+			}
+			if err != io.EOF {
+				clil.lines <- readResult{err: fmt.Errorf("ReadString() returns err: %w", err)}
+			}
+			return
 		}
+
+		clil.lines <- readResult{line: line, readAt: time.Now()}
 	}
 }
@@ -0,0 +1,126 @@
+package cli_test
+
+import (
+	"activity_log/api/apperror"
+	cli "activity_log/internal/user_input/service"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetUserInputTimeout(t *testing.T) {
+	reader, writer := io.Pipe()
+	listener := cli.NewCLIListener(reader)
+
+	if _, err := listener.GetUserInput(context.Background(), 10*time.Millisecond); !apperror.IsTimeoutError(err) {
+		t.Fatalf("GetUserInput() with no input returns %v, want a TimeoutError", err)
+	}
+
+	// The line typed after the timeout answered the prompt that gave up, so
+	// the next call drops it.
+	if _, err := writer.Write([]byte("late answer\n")); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	go writer.Write([]byte("next answer\n"))
+
+	ui, err := listener.GetUserInput(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("GetUserInput() returns err: %v", err)
+	}
+	if ui.Text != "next answer" {
+		t.Errorf("GetUserInput() returns %q, want %q", ui.Text, "next answer")
+	}
+
+	writer.Close()
+	if _, err := listener.GetUserInput(context.Background(), time.Second); !errors.Is(err, io.EOF) {
+		t.Errorf("GetUserInput() after input closed returns %v, want io.EOF", err)
+	}
+}
+
+// typeLine writes line once the reader has taken it, and waits a little
+// so it has come in before the next call starts.
+func typeLine(t *testing.T, writer io.Writer, line string) {
+	t.Helper()
+	if _, err := writer.Write([]byte(line + "\n")); err != nil {
+		t.Fatalf("Write() returns err: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+}
+
+func wantInput(t *testing.T, listener *cli.CLIListener, want string) {
+	t.Helper()
+	ui, err := listener.GetUserInput(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("GetUserInput() returns err: %v", err)
+	}
+	if ui.Text != want {
+		t.Errorf("GetUserInput() returns %q, want %q", ui.Text, want)
+	}
+}
+
+func TestGetUserInputTwoTimeouts(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	listener := cli.NewCLIListener(reader)
+
+	for i := 0; i < 2; i++ {
+		if _, err := listener.GetUserInput(context.Background(), 10*time.Millisecond); !apperror.IsTimeoutError(err) {
+			t.Fatalf("GetUserInput() with no input returns %v, want a TimeoutError", err)
+		}
+	}
+
+	typeLine(t, writer, "late answer")
+	go writer.Write([]byte("next answer\n"))
+	wantInput(t, listener, "next answer")
+}
+
+func TestGetUserInputTypeAheadAfterAnswer(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	listener := cli.NewCLIListener(reader)
+
+	if _, err := listener.GetUserInput(context.Background(), 10*time.Millisecond); !apperror.IsTimeoutError(err) {
+		t.Fatalf("GetUserInput() with no input returns %v, want a TimeoutError", err)
+	}
+	go writer.Write([]byte("answer\n"))
+	wantInput(t, listener, "answer")
+
+	// Only the call right after a timeout drops what came in before it.
+	typeLine(t, writer, "typed ahead")
+	wantInput(t, listener, "typed ahead")
+}
+
+func TestGetUserInputLines(t *testing.T) {
+	listener := cli.NewCLIListener(strings.NewReader("  first line \nsecond"))
+
+	for _, want := range []string{"first line", "second"} {
+		ui, err := listener.GetUserInput(context.Background(), 0)
+		if err != nil {
+			t.Fatalf("GetUserInput() returns err: %v", err)
+		}
+		if ui.Text != want {
+			t.Errorf("GetUserInput() returns %q, want %q", ui.Text, want)
+		}
+	}
+
+	if _, err := listener.GetUserInput(context.Background(), 0); !errors.Is(err, io.EOF) {
+		t.Errorf("GetUserInput() at the end of input returns %v, want io.EOF", err)
+	}
+}
+
+func TestGetUserInputCanceled(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	listener := cli.NewCLIListener(reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := listener.GetUserInput(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetUserInput() after cancel returns %v, want context.Canceled", err)
+	}
+}
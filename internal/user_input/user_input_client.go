@@ -1,53 +1,136 @@
 package user_input
 
 import (
+	"activity_log/api/apperror"
 	"activity_log/api/constructs"
+	"activity_log/internal/user_output"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"time"
 )
 
 type service interface {
-	GetUserInput(timeout time.Duration) (*constructs.UserInput, error)
+	GetUserInput(ctx context.Context, timeout time.Duration) (*constructs.UserInput, error)
 }
 
+// UserListener is the only reader of the listening service. Prompts from any
+// goroutine wait their turn and are put to the user one at a time, each
+// question shown right before the input that answers it is read, so an
+// answer always belongs to the question printed last.
 type UserListener struct {
 	listeningService service
+	userMessenger    *user_output.UserMessenger
+
+	prompts chan *prompt
+}
+
+// prompt is one question waiting for, or getting, the user's attention.
+type prompt struct {
+	ctx          context.Context
+	question     string
+	timeoutLimit time.Duration
+	maxRetries   int
+	invariants   func(*constructs.UserInput) error
+
+	answers chan answer
+}
+
+type answer struct {
+	userInput *constructs.UserInput
+	err       error
 }
 
-func New(listeningService service) *UserListener {
+func New(listeningService service, userMessenger *user_output.UserMessenger) *UserListener {
 	return &UserListener{
 		listeningService: listeningService,
+		userMessenger:    userMessenger,
+		prompts:          make(chan *prompt),
 	}
+}
 
+// Serve puts prompts to the user, in the order they were asked, until ctx is
+// done. Ask blocks until Serve is running.
+func (ul *UserListener) Serve(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p := <-ul.prompts:
+			ui, err := ul.getUserInput(p)
+			p.answers <- answer{userInput: ui, err: err}
+		}
+	}
 }
 
-// Try to get the input {maxRetries} times with a {timeoutLimit} on
-// each individual retry and check response satisfies {invariants}.
-func (ul *UserListener) GetUserInput(
+// Ask queues {question} behind any prompts asked before it, then tries to get
+// the input {maxRetries} times with a {timeoutLimit} on each individual retry
+// and check response satisfies {invariants}. The timeout starts once the
+// question is shown, not while it waits its turn.
+// Timeouts, the end of input and a done ctx aren't retried, the user isn't
+// confused, they're gone.
+func (ul *UserListener) Ask(
+	ctx context.Context,
+	question string,
 	timeoutLimit time.Duration,
 	maxRetries int,
 	invariants func(*constructs.UserInput) error,
 ) (*constructs.UserInput, error) {
-	retriesLeft := maxRetries
+	p := &prompt{
+		ctx:          ctx,
+		question:     question,
+		timeoutLimit: timeoutLimit,
+		maxRetries:   maxRetries,
+		invariants:   invariants,
+		answers:      make(chan answer, 1),
+	}
+
+	select {
+	case ul.prompts <- p:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	a := <-p.answers
+	return a.userInput, a.err
+}
+
+func (ul *UserListener) getUserInput(p *prompt) (*constructs.UserInput, error) {
+	if err := p.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if p.question != "" {
+		if err := ul.userMessenger.Send(p.question); err != nil {
+			return nil, fmt.Errorf("userMessenger.Send() returns err: %w", err)
+		}
+	}
+
+	retriesLeft := p.maxRetries
 
 	var ui *constructs.UserInput
 	var err error
 	for retriesLeft >= 0 {
-		ui, err = ul.listeningService.GetUserInput(timeoutLimit)
+		ui, err = ul.listeningService.GetUserInput(p.ctx, p.timeoutLimit)
+		if apperror.IsTimeoutError(err) || errors.Is(err, io.EOF) || p.ctx.Err() != nil {
+			return nil, err
+		}
 		if err != nil {
 			retriesLeft--
 			continue
 		}
 
-		if err = invariants(ui); err == nil {
+		if err = p.invariants(ui); err == nil {
 			return ui, nil
 		}
 
-		// TODO(luca): use messenger
-		fmt.Printf("Invalid input: %v\n", err)
+		if err := ul.userMessenger.Send(fmt.Sprintf("Invalid input: %v", err)); err != nil {
+			return nil, fmt.Errorf("userMessenger.Send() returns err: %w", err)
+		}
 
 		retriesLeft--
 	}
 
-	return nil, fmt.Errorf("failed after %d attempts. User input: %+v. Last err: %w", maxRetries, ui, err)
+	return nil, fmt.Errorf("failed after %d attempts. User input: %+v. Last err: %w", p.maxRetries, ui, err)
 }
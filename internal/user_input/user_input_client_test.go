@@ -0,0 +1,151 @@
+package user_input_test
+
+import (
+	"activity_log/api/constructs"
+	"activity_log/internal/user_input"
+	"activity_log/internal/user_output"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedService answers whichever question was shown last with the next
+// scripted answer for it. It is also where the messenger writes, so it sees
+// every question and can tell when two were shown without a read between.
+type scriptedService struct {
+	t *testing.T
+
+	mu         sync.Mutex
+	answers    map[string][]string
+	lastShown  string
+	unanswered int
+	transcript []string
+}
+
+func (ss *scriptedService) Write(p []byte) (int, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	msg := strings.TrimSuffix(string(p), "\n")
+	ss.transcript = append(ss.transcript, msg)
+	if _, ok := ss.answers[msg]; ok {
+		ss.lastShown = msg
+		ss.unanswered++
+	}
+	return len(p), nil
+}
+
+func (ss *scriptedService) GetUserInput(_ context.Context, _ time.Duration) (*constructs.UserInput, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.unanswered > 1 {
+		ss.t.Errorf("%d questions were shown before a read: %q", ss.unanswered, ss.transcript)
+	}
+	ss.unanswered = 0
+
+	script := ss.answers[ss.lastShown]
+	if len(script) == 0 {
+		return nil, io.EOF
+	}
+	ss.answers[ss.lastShown] = script[1:]
+
+	ss.transcript = append(ss.transcript, "> "+script[0])
+	return &constructs.UserInput{Text: script[0]}, nil
+}
+
+func newListener(t *testing.T, answers map[string][]string) (*user_input.UserListener, *scriptedService) {
+	ss := &scriptedService{t: t, answers: answers}
+	ul := user_input.New(ss, user_output.NewUserMessenger(ss))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go ul.Serve(ctx)
+
+	return ul, ss
+}
+
+func anything(*constructs.UserInput) error {
+	return nil
+}
+
+func TestAskAnswersEachQuestion(t *testing.T) {
+	const askers = 20
+
+	answers := map[string][]string{}
+	for i := 0; i < askers; i++ {
+		answers[fmt.Sprintf("question %d?", i)] = []string{fmt.Sprintf("answer %d", i)}
+	}
+	ul, _ := newListener(t, answers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < askers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ui, err := ul.Ask(context.Background(), fmt.Sprintf("question %d?", i), time.Second, 0, anything)
+			if err != nil {
+				t.Errorf("Ask(question %d) returns err: %v", i, err)
+				return
+			}
+			if want := fmt.Sprintf("answer %d", i); ui.Text != want {
+				t.Errorf("Ask(question %d) returns %q, want %q", i, ui.Text, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestAskRetriesInvalidInput(t *testing.T) {
+	ul, ss := newListener(t, map[string][]string{
+		"How many minutes?": {"lots", "15"},
+	})
+
+	ui, err := ul.Ask(context.Background(), "How many minutes?", time.Second, 1, func(ui *constructs.UserInput) error {
+		if _, err := strconv.Atoi(ui.Text); err != nil {
+			return fmt.Errorf("input must be a digit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Ask() returns err: %v", err)
+	}
+	if ui.Text != "15" {
+		t.Errorf("Ask() returns %q, want %q", ui.Text, "15")
+	}
+
+	want := []string{"How many minutes?", "> lots", "Invalid input: input must be a digit", "> 15"}
+	if got := ss.transcript; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("transcript: got %q, want %q", got, want)
+	}
+}
+
+func TestAskEndOfInput(t *testing.T) {
+	ul, _ := newListener(t, map[string][]string{
+		"Anyone there?": {},
+	})
+
+	if _, err := ul.Ask(context.Background(), "Anyone there?", time.Second, 3, anything); !errors.Is(err, io.EOF) {
+		t.Errorf("Ask() at the end of input returns %v, want io.EOF", err)
+	}
+}
+
+func TestAskCanceledWhileQueued(t *testing.T) {
+	// Nothing serves prompts, so this one never leaves the queue.
+	ss := &scriptedService{t: t}
+	ul := user_input.New(ss, user_output.NewUserMessenger(ss))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := ul.Ask(ctx, "Hello?", time.Second, 0, anything); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ask() returns %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -1,11 +1,30 @@
 package user_output
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
+// UserMessenger writes to stdout unless made with NewUserMessenger.
 type UserMessenger struct {
+	out io.Writer
+}
+
+func NewUserMessenger(out io.Writer) *UserMessenger {
+	return &UserMessenger{
+		out: out,
+	}
 }
 
 func (um *UserMessenger) Send(msg string) error {
-	fmt.Printf("%s\n", msg)
+	out := um.out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if _, err := fmt.Fprintf(out, "%s\n", msg); err != nil {
+		return fmt.Errorf("fmt.Fprintf() returns err: %w", err)
+	}
 	return nil
 }
@@ -8,6 +8,7 @@ import (
 
 type ExpandingMap struct {
 	data map[string]*ExpandingMap
+	meta NodeMeta
 }
 
 func NewExpandingMap(input map[string]interface{}) (*ExpandingMap, error) {
@@ -58,6 +59,78 @@ func (em *ExpandingMap) IsEmpty() bool {
 	return len(em.data) == 0
 }
 
+// Keys returns the keys directly under em, sorted.
+func (em *ExpandingMap) Keys() []string {
+	keys := []string{}
+	for key := range em.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// VisibleKeys returns the keys directly under em that aren't archived, sorted.
+func (em *ExpandingMap) VisibleKeys() []string {
+	keys := []string{}
+	for _, key := range em.Keys() {
+		if !em.data[key].meta.Archived {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Meta returns what em keeps about the key it's the submap of.
+func (em *ExpandingMap) Meta() NodeMeta {
+	return em.meta
+}
+
+// SetMeta replaces what em keeps about the key at path.
+func (em *ExpandingMap) SetMeta(path []string, meta NodeMeta) error {
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+	_, _, subMap, err := em.lookUp(path)
+	if err != nil {
+		return err
+	}
+	subMap.meta = meta
+	return nil
+}
+
+// IsArchived reports whether the key at path, or one above it, is archived.
+func (em *ExpandingMap) IsArchived(path []string) bool {
+	current := em
+	for _, key := range path {
+		next, ok := current.data[key]
+		if !ok {
+			return false
+		}
+		if next.meta.Archived {
+			return true
+		}
+		current = next
+	}
+	return false
+}
+
+// ArchivedPaths returns the paths of the archived keys, sorted, leaving out
+// those under an archived key.
+func (em *ExpandingMap) ArchivedPaths() [][]string {
+	paths := [][]string{}
+	for _, key := range em.Keys() {
+		subMap := em.data[key]
+		if subMap.meta.Archived {
+			paths = append(paths, []string{key})
+			continue
+		}
+		for _, subPath := range subMap.ArchivedPaths() {
+			paths = append(paths, append([]string{key}, subPath...))
+		}
+	}
+	return paths
+}
+
 func (em *ExpandingMap) GetSubMap(path []string) (*ExpandingMap, error) {
 	if len(path) == 0 {
 		return em, nil
@@ -143,6 +216,10 @@ func (em *ExpandingMap) IsEqual(otherEm *ExpandingMap) error {
 			return fmt.Errorf("other missing key %q: want: %v, got: %v", key, thisKeys, otherKeys)
 		}
 
+		if em.data[key].meta != otherVal.meta {
+			return fmt.Errorf("metadata differs at key %q: want: %+v, got: %+v", key, em.data[key].meta, otherVal.meta)
+		}
+
 		if em.data[key].IsEmpty() {
 			if !otherVal.IsEmpty() {
 				return fmt.Errorf("this map is empty, but the other isn't")
@@ -176,3 +253,191 @@ func (em *ExpandingMap) ToRegularMap() map[string]interface{} {
 
 	return output
 }
+
+// Copy returns a deep copy of em.
+func (em *ExpandingMap) Copy() *ExpandingMap {
+	cp := &ExpandingMap{
+		data: map[string]*ExpandingMap{},
+		meta: em.meta,
+	}
+	for key, val := range em.data {
+		cp.data[key] = val.Copy()
+	}
+	return cp
+}
+
+// Rebase makes em a copy of onto, plus the keys em added since it was base,
+// at any depth. Keys em added under a key onto no longer has are dropped
+// along with it, so whatever was renamed, moved or deleted stays that way.
+// What em keeps about a key wins over onto's if em changed it since base.
+func (em *ExpandingMap) Rebase(base *ExpandingMap, onto *ExpandingMap) {
+	rebased := onto.Copy()
+	rebased.addNew(em, base)
+	em.data = rebased.data
+	em.meta = rebased.meta
+}
+
+// addNew adds the keys of local that base doesn't have, and what local
+// changed about the keys it has. base is nil when everything under local is new.
+func (em *ExpandingMap) addNew(local *ExpandingMap, base *ExpandingMap) {
+	for key, localVal := range local.data {
+		var baseVal *ExpandingMap
+		if base != nil {
+			baseVal = base.data[key]
+		}
+
+		val, ok := em.data[key]
+		switch {
+		case !ok && baseVal == nil:
+			em.data[key] = localVal.Copy()
+		case ok:
+			if baseVal != nil && localVal.meta != baseVal.meta {
+				val.meta = localVal.meta
+			}
+			val.addNew(localVal, baseVal)
+		}
+	}
+}
+
+// Rename renames the key at path to newKey. The option standing for the key
+// itself, the one AddSubMapIncludingParent adds, is renamed along with it.
+func (em *ExpandingMap) Rename(path []string, newKey string) error {
+	parent, oldKey, subMap, err := em.lookUp(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := parent.data[newKey]; ok {
+		return fmt.Errorf("key %q already exists next to %v", newKey, path)
+	}
+
+	delete(parent.data, oldKey)
+	parent.data[newKey] = subMap
+
+	if self, ok := subMap.data[oldKey]; ok && self.IsEmpty() {
+		if _, ok := subMap.data[newKey]; !ok {
+			delete(subMap.data, oldKey)
+			subMap.data[newKey] = self
+		}
+	}
+
+	return nil
+}
+
+// Move moves the key at path, and everything under it, under newParent. A
+// newParent that had nothing under it keeps itself as an option, like
+// AddSubMapIncludingParent does.
+func (em *ExpandingMap) Move(path []string, newParent []string) error {
+	if pathHasPrefix(newParent, path) {
+		return fmt.Errorf("cannot move %v under itself", path)
+	}
+
+	parent, key, subMap, err := em.lookUp(path)
+	if err != nil {
+		return err
+	}
+	target, err := em.GetSubMap(newParent)
+	if err != nil {
+		return fmt.Errorf("GetSubMap(%v) returns err: %w", newParent, err)
+	}
+	if _, ok := target.data[key]; ok {
+		return fmt.Errorf("key %q already exists under %v", key, newParent)
+	}
+
+	if target.IsEmpty() && len(newParent) > 0 {
+		target.data[newParent[len(newParent)-1]] = NewEmptyExpandingMap()
+	}
+	delete(parent.data, key)
+	target.data[key] = subMap
+
+	return nil
+}
+
+// Delete removes the key at path and everything under it.
+func (em *ExpandingMap) Delete(path []string) error {
+	parent, key, _, err := em.lookUp(path)
+	if err != nil {
+		return err
+	}
+
+	delete(parent.data, key)
+	return nil
+}
+
+// lookUp returns the map holding the last key of path, that key and its submap.
+func (em *ExpandingMap) lookUp(path []string) (*ExpandingMap, string, *ExpandingMap, error) {
+	if len(path) == 0 {
+		return nil, "", nil, fmt.Errorf("path cannot be empty")
+	}
+
+	parent, err := em.GetSubMap(path[:len(path)-1])
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("GetSubMap(%v) returns err: %w", path[:len(path)-1], err)
+	}
+
+	key := path[len(path)-1]
+	subMap, ok := parent.data[key]
+	if !ok {
+		return nil, "", nil, apperror.NewNotFoundError(fmt.Errorf("no submap at %v", path))
+	}
+
+	return parent, key, subMap, nil
+}
+
+func pathHasPrefix(path []string, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for idx := range prefix {
+		if path[idx] != prefix[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// Fold merges the key at from, and everything under it, into the key at
+// into and removes it. Keys under both are folded together the same way at
+// any depth. A key that had nothing under it keeps itself as an option once
+// it has, like AddSubMapIncludingParent does, and the option standing for
+// from itself becomes the one standing for into.
+func (em *ExpandingMap) Fold(from []string, into []string) error {
+	if pathHasPrefix(into, from) || pathHasPrefix(from, into) {
+		return fmt.Errorf("cannot fold %v and %v, one is under the other", from, into)
+	}
+
+	parent, fromKey, fromMap, err := em.lookUp(from)
+	if err != nil {
+		return err
+	}
+	_, intoKey, intoMap, err := em.lookUp(into)
+	if err != nil {
+		return err
+	}
+
+	delete(parent.data, fromKey)
+	intoMap.fold(intoKey, fromMap, fromKey)
+
+	return nil
+}
+
+func (em *ExpandingMap) fold(key string, other *ExpandingMap, otherKey string) {
+	if other.IsEmpty() {
+		return
+	}
+	if em.IsEmpty() {
+		em.data[key] = NewEmptyExpandingMap()
+	}
+
+	for childKey, otherChild := range other.data {
+		if childKey == otherKey && otherChild.IsEmpty() {
+			childKey = key
+		}
+
+		child, ok := em.data[childKey]
+		if !ok {
+			em.data[childKey] = otherChild
+			continue
+		}
+		child.fold(childKey, otherChild, childKey)
+	}
+}
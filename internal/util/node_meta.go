@@ -0,0 +1,54 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeColors are the colors a key can be shown in.
+var NodeColors = []string{"red", "green", "yellow", "blue", "magenta", "cyan"}
+
+// NodeMeta is what an ExpandingMap keeps about a key besides the keys under it.
+type NodeMeta struct {
+	// Archived keys are left out of menus, but stay valid for what was logged against them.
+	Archived bool
+	// Description says what the key is for, next to it in menus.
+	Description string
+	// Color is one of NodeColors, or empty for the terminal's own.
+	Color string
+	// Billable time is billed at Rate an hour.
+	Billable bool
+	Rate     float64
+	// DailyTargetMinutes and WeeklyTargetMinutes are how long the user aims
+	// to spend on the key, and everything under it, a day and a week.
+	DailyTargetMinutes  int
+	WeeklyTargetMinutes int
+	// ExternalID ties the key to something elsewhere, e.g. a project code.
+	ExternalID string
+}
+
+// Validate returns an error if meta can't be kept as it is.
+func (meta NodeMeta) Validate() error {
+	if meta.Color != "" && !isNodeColor(meta.Color) {
+		return fmt.Errorf("%q isn't a color, pick one of %s", meta.Color, strings.Join(NodeColors, ", "))
+	}
+	if meta.Rate < 0 {
+		return fmt.Errorf("rate can't be negative, got %v", meta.Rate)
+	}
+	if meta.Rate != 0 && !meta.Billable {
+		return fmt.Errorf("only billable activities have a rate")
+	}
+	if meta.DailyTargetMinutes < 0 || meta.WeeklyTargetMinutes < 0 {
+		return fmt.Errorf("targets can't be negative")
+	}
+	return nil
+}
+
+func isNodeColor(color string) bool {
+	for _, c := range NodeColors {
+		if c == color {
+			return true
+		}
+	}
+	return false
+}
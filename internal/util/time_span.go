@@ -0,0 +1,187 @@
+package util
+
+import (
+	"activity_log/api/apperror"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxTimeSpan is the longest one answer can log.
+const MaxTimeSpan = 24 * time.Hour
+
+// TimeSpan is when an activity happened. Spans given only as a length end now.
+type TimeSpan struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (ts *TimeSpan) Duration() time.Duration {
+	return ts.End.Sub(ts.Start)
+}
+
+// Minutes rounds down, like the time since the last record always has.
+func (ts *TimeSpan) Minutes() int {
+	return int(ts.Duration().Minutes())
+}
+
+var (
+	minutesPattern  = regexp.MustCompile(`^-?\d+$`)
+	durationPattern = regexp.MustCompile(`^-?(\d+(\.\d+)?[hm])+$`)
+	sincePattern    = regexp.MustCompile(`^since (\d{1,2}:\d{2})$`)
+	rangePattern    = regexp.MustCompile(`^(\d{1,2}:\d{2}) *[-–—] *(\d{1,2}:\d{2})$`)
+	untilNowPattern = regexp.MustCompile(`^until now$`)
+)
+
+// LooksLikeTimeSpan reports whether text is meant as a time span, valid or
+// not, rather than say the name of a new option.
+func LooksLikeTimeSpan(text string) bool {
+	text = normalizeTimeSpan(text)
+	for _, pattern := range []*regexp.Regexp{minutesPattern, durationPattern, sincePattern, rangePattern, untilNowPattern} {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTimeSpan reads how long something took: bare minutes ("90"), a
+// duration ("1h30m", "90m", "1.5h"), a start time ("since 14:00"), a range
+// of times today ("14:00-15:30") or "until now", which starts at lastRecord.
+// Spans that are negative, longer than MaxTimeSpan or end after now return a
+// UserConfusedError.
+func ParseTimeSpan(text string, now time.Time, lastRecord time.Time) (*TimeSpan, error) {
+	text = normalizeTimeSpan(text)
+
+	var span *TimeSpan
+	switch {
+	case minutesPattern.MatchString(text):
+		minutes, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, apperror.NewUserConfusedError(fmt.Errorf("%q isn't a number of minutes", text))
+		}
+		span = &TimeSpan{Start: now.Add(-time.Duration(minutes) * time.Minute), End: now}
+	case durationPattern.MatchString(text):
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, apperror.NewUserConfusedError(fmt.Errorf("%q isn't a duration like 1h30m", text))
+		}
+		span = &TimeSpan{Start: now.Add(-d), End: now}
+	case sincePattern.MatchString(text):
+		start, err := timeToday(sincePattern.FindStringSubmatch(text)[1], now)
+		if err != nil {
+			return nil, err
+		}
+		span = &TimeSpan{Start: start, End: now}
+	case rangePattern.MatchString(text):
+		var err error
+		if span, err = ParseClockRange(text, now); err != nil {
+			return nil, err
+		}
+	case untilNowPattern.MatchString(text):
+		span = &TimeSpan{Start: lastRecord, End: now}
+	default:
+		return nil, apperror.NewUserConfusedError(fmt.Errorf("%q isn't a time span, try 45, 1h30m, since 14:00 or 14:00-15:30", text))
+	}
+
+	if span.Duration() < 0 {
+		if strings.HasPrefix(text, "-") {
+			return nil, apperror.NewUserConfusedError(fmt.Errorf("%q is negative", text))
+		}
+		return nil, apperror.NewUserConfusedError(fmt.Errorf("%q ends before it starts", text))
+	}
+	if span.Duration() > MaxTimeSpan {
+		return nil, apperror.NewUserConfusedError(fmt.Errorf("%q is longer than %d hours", text, int(MaxTimeSpan.Hours())))
+	}
+	if span.End.After(now) {
+		return nil, apperror.NewUserConfusedError(fmt.Errorf("%q hasn't happened yet", text))
+	}
+
+	return span, nil
+}
+
+// IsClockRange reports whether text is a range of clock times like 14:00-15:30.
+func IsClockRange(text string) bool {
+	return rangePattern.MatchString(normalizeTimeSpan(text))
+}
+
+// ParseClockRange reads a range of clock times like 14:00-15:30 on the day of {day}.
+func ParseClockRange(text string, day time.Time) (*TimeSpan, error) {
+	match := rangePattern.FindStringSubmatch(normalizeTimeSpan(text))
+	if match == nil {
+		return nil, apperror.NewUserConfusedError(fmt.Errorf("%q isn't a range of times like 14:00-15:30", text))
+	}
+
+	start, err := timeToday(match[1], day)
+	if err != nil {
+		return nil, err
+	}
+	end, err := timeToday(match[2], day)
+	if err != nil {
+		return nil, err
+	}
+
+	if end.Before(start) {
+		return nil, apperror.NewUserConfusedError(fmt.Errorf("%q ends before it starts", text))
+	}
+
+	return &TimeSpan{Start: start, End: end}, nil
+}
+
+// ParseDay reads a day relative to now: empty or "today", "yesterday" or
+// YYYY-MM-DD. Days still to come return a UserConfusedError.
+func ParseDay(text string, now time.Time) (time.Time, error) {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "", "today":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(text), now.Location())
+	if err != nil {
+		return time.Time{}, apperror.NewUserConfusedError(fmt.Errorf("%q isn't today, yesterday or a date like 2021-11-12", text))
+	}
+	if day.After(now) {
+		return time.Time{}, apperror.NewUserConfusedError(fmt.Errorf("%q hasn't happened yet", text))
+	}
+	return day, nil
+}
+
+// StartOfDay is midnight at the start of the day of t.
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// StartOfWeek is midnight at the start of the Monday of the week of t.
+func StartOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return StartOfDay(t).AddDate(0, 0, -daysSinceMonday)
+}
+
+func normalizeTimeSpan(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// timeToday is the clock time text, e.g. 14:00, on the day of {now}.
+func timeToday(text string, now time.Time) (time.Time, error) {
+	clock, err := time.Parse("15:04", text)
+	if err != nil {
+		return time.Time{}, apperror.NewUserConfusedError(fmt.Errorf("%q isn't a time of day like 14:00", text))
+	}
+
+	return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location()), nil
+}
+
+// FormatMinutes reads like the durations ParseTimeSpan accepts, e.g. 1h30m.
+func FormatMinutes(minutes int) string {
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%dh", minutes/60)
+	}
+	return fmt.Sprintf("%dh%dm", minutes/60, minutes%60)
+}
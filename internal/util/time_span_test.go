@@ -0,0 +1,154 @@
+package util_test
+
+import (
+	"activity_log/api/apperror"
+	"activity_log/internal/util"
+	"testing"
+	"time"
+)
+
+func TestParseTimeSpan(t *testing.T) {
+	now := time.Date(2021, time.November, 12, 16, 0, 0, 0, time.UTC)
+	lastRecord := now.Add(-40 * time.Minute)
+
+	testCases := []struct {
+		desc        string
+		text        string
+		wantMinutes int
+		wantStart   time.Time
+		wantErr     bool
+	}{
+		{
+			desc:        "bare minutes",
+			text:        "90",
+			wantMinutes: 90,
+			wantStart:   now.Add(-90 * time.Minute),
+		},
+		{
+			desc:        "hours and minutes",
+			text:        "1h30m",
+			wantMinutes: 90,
+			wantStart:   now.Add(-90 * time.Minute),
+		},
+		{
+			desc:        "minutes with a unit",
+			text:        "90m",
+			wantMinutes: 90,
+			wantStart:   now.Add(-90 * time.Minute),
+		},
+		{
+			desc:        "fractional hours",
+			text:        "1.5H",
+			wantMinutes: 90,
+			wantStart:   now.Add(-90 * time.Minute),
+		},
+		{
+			desc:        "since",
+			text:        "since 14:00",
+			wantMinutes: 120,
+			wantStart:   time.Date(2021, time.November, 12, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:        "range with an en dash",
+			text:        "14:00–15:30",
+			wantMinutes: 90,
+			wantStart:   time.Date(2021, time.November, 12, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:        "range with spaces",
+			text:        "9:05 - 9:35",
+			wantMinutes: 30,
+			wantStart:   time.Date(2021, time.November, 12, 9, 5, 0, 0, time.UTC),
+		},
+		{
+			desc:        "until now",
+			text:        "until now",
+			wantMinutes: 40,
+			wantStart:   lastRecord,
+		},
+		{
+			desc:    "negative minutes",
+			text:    "-5",
+			wantErr: true,
+		},
+		{
+			desc:    "negative duration",
+			text:    "-1h",
+			wantErr: true,
+		},
+		{
+			desc:    "since a time later today",
+			text:    "since 17:00",
+			wantErr: true,
+		},
+		{
+			desc:    "range ending later today",
+			text:    "15:00-17:00",
+			wantErr: true,
+		},
+		{
+			desc:    "range ending before it starts",
+			text:    "15:30-14:00",
+			wantErr: true,
+		},
+		{
+			desc:    "more than a day",
+			text:    "25h",
+			wantErr: true,
+		},
+		{
+			desc:    "more than a day in minutes",
+			text:    "1441",
+			wantErr: true,
+		},
+		{
+			desc:    "not a time of day",
+			text:    "since 25:00",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if !util.LooksLikeTimeSpan(tc.text) {
+				t.Errorf("LooksLikeTimeSpan(%q) = false, want true", tc.text)
+			}
+
+			span, err := util.ParseTimeSpan(tc.text, now, lastRecord)
+			if tc.wantErr {
+				if !apperror.IsUserConfusedError(err) {
+					t.Fatalf("ParseTimeSpan(%q) returns %+v, %v, want a UserConfusedError", tc.text, span, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimeSpan(%q) returns err: %v", tc.text, err)
+			}
+
+			if got := span.Minutes(); got != tc.wantMinutes {
+				t.Errorf("ParseTimeSpan(%q).Minutes() = %d, want %d", tc.text, got, tc.wantMinutes)
+			}
+			if !span.Start.Equal(tc.wantStart) {
+				t.Errorf("ParseTimeSpan(%q).Start = %v, want %v", tc.text, span.Start, tc.wantStart)
+			}
+		})
+	}
+}
+
+func TestLooksLikeTimeSpan(t *testing.T) {
+	for _, text := range []string{"reading", "1on1", "h", "meeting 14:00", ""} {
+		if util.LooksLikeTimeSpan(text) {
+			t.Errorf("LooksLikeTimeSpan(%q) = true, want false", text)
+		}
+	}
+}
+
+func TestStartOfWeek(t *testing.T) {
+	want := time.Date(2021, 11, 8, 0, 0, 0, 0, time.UTC)
+	for _, day := range []int{8, 11, 14} {
+		now := time.Date(2021, 11, day, 15, 30, 0, 0, time.UTC)
+		if got := util.StartOfWeek(now); !got.Equal(want) {
+			t.Errorf("StartOfWeek(%v) = %v, want %v", now, got, want)
+		}
+	}
+}
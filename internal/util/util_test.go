@@ -2,6 +2,7 @@ package util_test
 
 import (
 	"activity_log/internal/util"
+	"reflect"
 	"testing"
 )
 
@@ -354,3 +355,427 @@ func TestConstructionFromScratch(t *testing.T) {
 		t.Fatalf("maps not equal: %v", err)
 	}
 }
+
+func TestRebase(t *testing.T) {
+	base := map[string]interface{}{
+		"default": nil,
+		"working": map[string]interface{}{
+			"coding":  nil,
+			"meeting": nil,
+		},
+	}
+
+	testCases := []struct {
+		desc string
+		// mine adds to base.
+		mine map[string]interface{}
+		// theirs is what was stored meanwhile.
+		theirs map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			desc: "both add",
+			mine: map[string]interface{}{
+				"default": nil,
+				"working": map[string]interface{}{
+					"coding":  nil,
+					"meeting": nil,
+					"review":  nil,
+				},
+			},
+			theirs: map[string]interface{}{
+				"default": nil,
+				"working": map[string]interface{}{
+					"coding": map[string]interface{}{
+						"coding":    nil,
+						"debugging": nil,
+					},
+					"meeting": nil,
+				},
+				"SideProject": nil,
+			},
+			want: map[string]interface{}{
+				"default": nil,
+				"working": map[string]interface{}{
+					"coding": map[string]interface{}{
+						"coding":    nil,
+						"debugging": nil,
+					},
+					"meeting": nil,
+					"review":  nil,
+				},
+				"SideProject": nil,
+			},
+		},
+		{
+			desc: "they rename a key",
+			mine: map[string]interface{}{
+				"default": nil,
+				"working": map[string]interface{}{
+					"coding":  nil,
+					"meeting": nil,
+				},
+				"reading": nil,
+			},
+			theirs: map[string]interface{}{
+				"default": nil,
+				"work": map[string]interface{}{
+					"coding":  nil,
+					"meeting": nil,
+				},
+			},
+			want: map[string]interface{}{
+				"default": nil,
+				"work": map[string]interface{}{
+					"coding":  nil,
+					"meeting": nil,
+				},
+				"reading": nil,
+			},
+		},
+		{
+			desc: "they delete the key mine added under",
+			mine: map[string]interface{}{
+				"default": nil,
+				"working": map[string]interface{}{
+					"coding":  nil,
+					"meeting": nil,
+					"review":  nil,
+				},
+			},
+			theirs: map[string]interface{}{
+				"default": nil,
+			},
+			want: map[string]interface{}{
+				"default": nil,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			baseMap, err := util.NewExpandingMap(base)
+			if err != nil {
+				t.Fatalf("NewExpandingMap(base) returns err: %v", err)
+			}
+			mine, err := util.NewExpandingMap(tc.mine)
+			if err != nil {
+				t.Fatalf("NewExpandingMap(mine) returns err: %v", err)
+			}
+			theirs, err := util.NewExpandingMap(tc.theirs)
+			if err != nil {
+				t.Fatalf("NewExpandingMap(theirs) returns err: %v", err)
+			}
+
+			mine.Rebase(baseMap, theirs)
+
+			if err := util.NestedMapsEqual(tc.want, mine.ToRegularMap()); err != nil {
+				t.Errorf("Rebase() result differs: want %+v, got %+v, err: %v", tc.want, mine.ToRegularMap(), err)
+			}
+		})
+	}
+}
+
+func TestRebaseMeta(t *testing.T) {
+	newMap := func() *util.ExpandingMap {
+		em, err := util.NewExpandingMap(map[string]interface{}{
+			"working": map[string]interface{}{
+				"coding":  nil,
+				"meeting": nil,
+			},
+			"reading": nil,
+		})
+		if err != nil {
+			t.Fatalf("NewExpandingMap() returns err: %v", err)
+		}
+		return em
+	}
+	setMeta := func(em *util.ExpandingMap, path []string, meta util.NodeMeta) {
+		if err := em.SetMeta(path, meta); err != nil {
+			t.Fatalf("SetMeta(%v) returns err: %v", path, err)
+		}
+	}
+
+	base := newMap()
+	setMeta(base, []string{"reading"}, util.NodeMeta{Color: "blue"})
+
+	// Both change working, only they change coding and only mine changes reading.
+	mine := base.Copy()
+	setMeta(mine, []string{"working"}, util.NodeMeta{Color: "red"})
+	setMeta(mine, []string{"reading"}, util.NodeMeta{Archived: true})
+	theirs := base.Copy()
+	setMeta(theirs, []string{"working"}, util.NodeMeta{Description: "paid work"})
+	setMeta(theirs, []string{"working", "coding"}, util.NodeMeta{DailyTargetMinutes: 120})
+
+	mine.Rebase(base, theirs)
+
+	for _, tc := range []struct {
+		path []string
+		want util.NodeMeta
+	}{
+		{path: []string{"working"}, want: util.NodeMeta{Color: "red"}},
+		{path: []string{"working", "coding"}, want: util.NodeMeta{DailyTargetMinutes: 120}},
+		{path: []string{"reading"}, want: util.NodeMeta{Archived: true}},
+	} {
+		subMap, err := mine.GetSubMap(tc.path)
+		if err != nil {
+			t.Fatalf("GetSubMap(%v) returns err: %v", tc.path, err)
+		}
+		if got := subMap.Meta(); got != tc.want {
+			t.Errorf("Meta() at %v after Rebase(): got %+v, want %+v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestRenameMoveDelete(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		edit    func(em *util.ExpandingMap) error
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			desc: "rename leaf",
+			edit: func(em *util.ExpandingMap) error {
+				return em.Rename([]string{"working", "coding", "reconciling_bad_code"}, "refactoring")
+			},
+			want: map[string]interface{}{
+				"default":     nil,
+				"SideProject": nil,
+				"working": map[string]interface{}{
+					"working": nil,
+					"coding": map[string]interface{}{
+						"coding":      nil,
+						"refactoring": nil,
+					},
+				},
+			},
+		},
+		{
+			desc: "rename renames the option standing for itself",
+			edit: func(em *util.ExpandingMap) error {
+				return em.Rename([]string{"working", "coding"}, "programming")
+			},
+			want: map[string]interface{}{
+				"default":     nil,
+				"SideProject": nil,
+				"working": map[string]interface{}{
+					"working": nil,
+					"programming": map[string]interface{}{
+						"programming":          nil,
+						"reconciling_bad_code": nil,
+					},
+				},
+			},
+		},
+		{
+			desc: "move under a leaf keeps the leaf",
+			edit: func(em *util.ExpandingMap) error {
+				return em.Move([]string{"working", "coding"}, []string{"SideProject"})
+			},
+			want: map[string]interface{}{
+				"default": nil,
+				"SideProject": map[string]interface{}{
+					"SideProject": nil,
+					"coding": map[string]interface{}{
+						"coding":               nil,
+						"reconciling_bad_code": nil,
+					},
+				},
+				"working": map[string]interface{}{
+					"working": nil,
+				},
+			},
+		},
+		{
+			desc: "move to the top",
+			edit: func(em *util.ExpandingMap) error {
+				return em.Move([]string{"working", "coding"}, nil)
+			},
+			want: map[string]interface{}{
+				"default":     nil,
+				"SideProject": nil,
+				"coding": map[string]interface{}{
+					"coding":               nil,
+					"reconciling_bad_code": nil,
+				},
+				"working": map[string]interface{}{
+					"working": nil,
+				},
+			},
+		},
+		{
+			desc: "delete",
+			edit: func(em *util.ExpandingMap) error {
+				return em.Delete([]string{"working", "coding"})
+			},
+			want: map[string]interface{}{
+				"default":     nil,
+				"SideProject": nil,
+				"working": map[string]interface{}{
+					"working": nil,
+				},
+			},
+		},
+		{
+			desc: "rename onto a sibling",
+			edit: func(em *util.ExpandingMap) error {
+				return em.Rename([]string{"working", "coding"}, "working")
+			},
+			wantErr: true,
+		},
+		{
+			desc: "move under itself",
+			edit: func(em *util.ExpandingMap) error {
+				return em.Move([]string{"working"}, []string{"working", "coding"})
+			},
+			wantErr: true,
+		},
+		{
+			desc: "delete missing",
+			edit: func(em *util.ExpandingMap) error {
+				return em.Delete([]string{"working", "meeting"})
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			em, err := util.NewExpandingMap(map[string]interface{}{
+				"default":     nil,
+				"SideProject": nil,
+				"working": map[string]interface{}{
+					"working": nil,
+					"coding": map[string]interface{}{
+						"coding":               nil,
+						"reconciling_bad_code": nil,
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewExpandingMap() returns err: %v", err)
+			}
+
+			err = tc.edit(em)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("edit returns no err, want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("edit returns err: %v", err)
+			}
+
+			if err := util.NestedMapsEqual(tc.want, em.ToRegularMap()); err != nil {
+				t.Errorf("edit result differs: want %+v, got %+v, err: %v", tc.want, em.ToRegularMap(), err)
+			}
+		})
+	}
+}
+
+func TestFold(t *testing.T) {
+	em, err := util.NewExpandingMap(map[string]interface{}{
+		"default": nil,
+		"working": map[string]interface{}{
+			"meeting": map[string]interface{}{
+				"standup": nil,
+				"retro":   nil,
+			},
+			"meetings": map[string]interface{}{
+				"meetings": nil,
+				"standup":  nil,
+				"retro": map[string]interface{}{
+					"retro":  nil,
+					"sprint": nil,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewExpandingMap() returns err: %v", err)
+	}
+
+	if err := em.Fold([]string{"working", "meetings"}, []string{"working", "meeting"}); err != nil {
+		t.Fatalf("Fold() returns err: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"default": nil,
+		"working": map[string]interface{}{
+			"meeting": map[string]interface{}{
+				"meeting": nil,
+				"standup": nil,
+				"retro": map[string]interface{}{
+					"retro":  nil,
+					"sprint": nil,
+				},
+			},
+		},
+	}
+	if err := util.NestedMapsEqual(want, em.ToRegularMap()); err != nil {
+		t.Errorf("Fold() result differs: want %+v, got %+v, err: %v", want, em.ToRegularMap(), err)
+	}
+
+	if err := em.Fold([]string{"working"}, []string{"working", "meeting"}); err == nil {
+		t.Errorf("Fold() into its own key returns no err, want one")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	em, err := util.NewExpandingMap(map[string]interface{}{
+		"default": nil,
+		"working": map[string]interface{}{
+			"coding": map[string]interface{}{
+				"coding":    nil,
+				"debugging": nil,
+			},
+			"meeting": nil,
+		},
+		"SideProject": nil,
+	})
+	if err != nil {
+		t.Fatalf("NewExpandingMap() returns err: %v", err)
+	}
+
+	for _, path := range [][]string{{"working", "coding"}, {"working", "coding", "debugging"}, {"SideProject"}} {
+		if err := em.SetMeta(path, util.NodeMeta{Archived: true}); err != nil {
+			t.Fatalf("SetMeta(%v) returns err: %v", path, err)
+		}
+	}
+
+	if got, want := em.VisibleKeys(), []string{"default", "working"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("VisibleKeys() returns %v, want %v", got, want)
+	}
+	working, _ := em.GetSubMap([]string{"working"})
+	if got, want := working.VisibleKeys(), []string{"meeting"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("VisibleKeys() of working returns %v, want %v", got, want)
+	}
+	if !em.IsArchived([]string{"working", "coding", "coding"}) {
+		t.Errorf("IsArchived() of a sub-activity of an archived activity returns false, want true")
+	}
+	if em.IsArchived([]string{"working", "meeting"}) {
+		t.Errorf("IsArchived(working.meeting) returns true, want false")
+	}
+	// debugging is left out, being under coding.
+	if got, want := em.ArchivedPaths(), [][]string{{"SideProject"}, {"working", "coding"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ArchivedPaths() returns %v, want %v", got, want)
+	}
+
+	// What's archived moves along with the activity.
+	if err := em.Rename([]string{"working", "coding"}, "programming"); err != nil {
+		t.Fatalf("Rename() returns err: %v", err)
+	}
+	if !em.IsArchived([]string{"working", "programming"}) {
+		t.Errorf("IsArchived() after Rename() returns false, want true")
+	}
+
+	plain, err := util.NewExpandingMap(em.ToRegularMap())
+	if err != nil {
+		t.Fatalf("NewExpandingMap() returns err: %v", err)
+	}
+	if err := em.IsEqual(plain); err == nil {
+		t.Errorf("IsEqual() of maps archiving different keys returns no err, want one")
+	}
+}